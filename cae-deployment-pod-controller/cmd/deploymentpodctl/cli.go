@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/controller"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const usage = `Usage: deploymentpodctl [flags] <command> [args]
+
+Runs the controller when no command is given. Commands:
+  validate-config [file]   check a configuration file, defaulting to -config
+  list                     list current quarantines across namespaces
+  status <ns/workload>     show restart history and the policy in effect
+  restore <ns/workload>    restore saved replicas, triggers and settings, through the
+                           controller when the workload has an Active Quarantine
+  explain <ns/pod>         explain why the controller would or would not act
+  images [list]            list blocked image digests with the evidence for them
+  images block <digest> [image]
+                           block a digest, optionally with the image it was pushed as
+  images unblock <digest>  remove the block of a digest
+  images prune             remove expired blocks
+  blacklist test <host> [namespace]
+                           show which blacklist rule, if any, matches a route host
+  record <file>            record pod and workload events to a JSON-lines file
+  simulate <file>          replay a recording through the decision engine offline
+  webhook                  serve the validating admission webhook
+`
+
+// runCommand runs an operator subcommand and returns the process exit code.
+func runCommand(args []string) int {
+	command, args := args[0], args[1:]
+
+	var err error
+	switch command {
+	case "validate-config":
+		err = validateConfig(args)
+	case "list":
+		err = listQuarantines(args)
+	case "status":
+		err = workloadStatus(args)
+	case "restore":
+		err = restoreWorkload(args)
+	case "explain":
+		err = explainPod(args)
+	case "images":
+		err = manageImages(args)
+	case "blacklist":
+		err = manageBlacklist(args)
+	case "record":
+		err = recordEvents(args)
+	case "simulate":
+		err = simulateEvents(args)
+	case "webhook":
+		err = runWebhook(args)
+	case "help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// syncedController builds the controller the same way the entrypoint does, and
+// starts its informers and waits for their caches, without running any workers.
+func syncedController() (*controller.Controller, error) {
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	c, startInformers := newController(cfg)
+	stopCh := make(chan struct{})
+	startInformers(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
+		return nil, fmt.Errorf("failed to wait for caches to sync")
+	}
+	return c, nil
+}
+
+// namespacedArg parses the single '<namespace>/<name>' argument of a command.
+func namespacedArg(command string, args []string) (string, string, error) {
+	if len(args) != 1 {
+		return "", "", fmt.Errorf("%s takes exactly one <namespace>/<name> argument", command)
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(args[0])
+	if err != nil || len(namespace) == 0 {
+		return "", "", fmt.Errorf("invalid argument %q, expected <namespace>/<name>", args[0])
+	}
+	return namespace, name, nil
+}
+
+// age formats the time elapsed since t the way oc does, to the nearest unit.
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return time.Since(t.Time).Round(time.Second).String()
+}
+
+func listQuarantines(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("list takes no arguments")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	c, _ := newController(cfg)
+	quarantines, err := c.Quarantines(metav1.NamespaceAll)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tKIND\tWORKLOAD\tACTION\tPHASE\tAGE")
+	for _, quarantine := range quarantines {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", quarantine.Namespace, quarantine.Name,
+			quarantine.Spec.Workload.Kind, quarantine.Spec.Workload.Name, quarantine.Spec.Action,
+			quarantine.Status.Phase, age(quarantine.CreationTimestamp))
+	}
+	return w.Flush()
+}
+
+func workloadStatus(args []string) error {
+	namespace, name, err := namespacedArg("status", args)
+	if err != nil {
+		return err
+	}
+	c, err := syncedController()
+	if err != nil {
+		return err
+	}
+	kind, err := c.ResolveKind(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Workload: %s %s/%s\n\nPolicy:\n", kind, namespace, name)
+	for _, line := range c.Policy(namespace) {
+		fmt.Printf("  %s\n", line)
+	}
+
+	fmt.Println("\nRestart history:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  POD\tCONTAINER\tRESTARTS\tLAST REASON\tEXIT CODE\tFINISHED")
+	for _, pod := range c.WorkloadPods(kind, namespace, name) {
+		for _, status := range pod.Status.ContainerStatuses {
+			reason, exitCode, finished := "-", "-", "-"
+			if last := status.LastTerminationState.Terminated; last != nil {
+				reason, exitCode, finished = last.Reason, fmt.Sprint(last.ExitCode), age(last.FinishedAt)+" ago"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%s\t%s\t%s\n", pod.Name, status.Name, status.RestartCount, reason, exitCode, finished)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	quarantines, err := c.Quarantines(namespace)
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nQuarantines:")
+	for _, quarantine := range quarantines {
+		if quarantine.Spec.Workload.Kind != kind || quarantine.Spec.Workload.Name != name {
+			continue
+		}
+		fmt.Printf("  %s  %s  %s  %s ago  %s\n", quarantine.Name, quarantine.Status.Phase, quarantine.Spec.Action,
+			age(quarantine.CreationTimestamp), quarantine.Spec.Reason)
+		for key, value := range quarantine.Spec.OriginalState {
+			fmt.Printf("    %s: %s\n", key, value)
+		}
+	}
+	return nil
+}
+
+func restoreWorkload(args []string) error {
+	namespace, name, err := namespacedArg("restore", args)
+	if err != nil {
+		return err
+	}
+	c, err := syncedController()
+	if err != nil {
+		return err
+	}
+	kind, err := c.ResolveKind(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	quarantine, err := c.Release(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	if quarantine != nil {
+		fmt.Printf("Released Quarantine %s/%s, the controller restores %s %s/%s\n", quarantine.Namespace, quarantine.Name, kind, namespace, name)
+		return nil
+	}
+	fmt.Printf("Restored %s %s/%s\n", kind, namespace, name)
+	return nil
+}
+
+func explainPod(args []string) error {
+	namespace, name, err := namespacedArg("explain", args)
+	if err != nil {
+		return err
+	}
+	c, err := syncedController()
+	if err != nil {
+		return err
+	}
+
+	obj, exists, err := c.PodInformer.GetIndexer().GetByKey(fmt.Sprintf("%s/%s", namespace, name))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+
+	decision, err := c.Decide(obj.(*v1.Pod))
+	if err != nil {
+		return err
+	}
+	if decision.Act {
+		fmt.Printf("The controller WOULD act on pod %s: %s on %s %s\n", decision.Pod, decision.Action, decision.Kind, decision.Name)
+	} else {
+		fmt.Printf("The controller would NOT act on pod %s\n", decision.Pod)
+	}
+	for i, reason := range decision.Reasons {
+		fmt.Printf("  %d. %s\n", i+1, reason)
+	}
+	return nil
+}
+
+// manageImages runs the images subcommands, which work on the blocked images
+// ConfigMap through the API.
+func manageImages(args []string) error {
+	command := "list"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	c, _ := newController(cfg)
+
+	switch command {
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("images list takes no arguments")
+		}
+		return listBlockedImages(c)
+	case "block":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("images block takes a <digest> and an optional [image] argument")
+		}
+		image := ""
+		if len(args) == 2 {
+			image = args[1]
+		}
+		if err := c.BlockImage(args[0], image, fmt.Sprintf("blocked by %s", operator())); err != nil {
+			return err
+		}
+		fmt.Printf("Blocked image %s\n", args[0])
+	case "unblock":
+		if len(args) != 1 {
+			return fmt.Errorf("images unblock takes exactly one <digest> argument")
+		}
+		if err := c.UnblockImage(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Unblocked image %s\n", args[0])
+	case "prune":
+		if len(args) != 0 {
+			return fmt.Errorf("images prune takes no arguments")
+		}
+		pruned, err := c.PruneBlockedImages()
+		if err != nil {
+			return err
+		}
+		for _, digest := range pruned {
+			fmt.Printf("Pruned expired block of image %s\n", digest)
+		}
+		fmt.Printf("%d expired blocks pruned\n", len(pruned))
+	default:
+		return fmt.Errorf("unknown images command %q, expected list, block, unblock or prune", command)
+	}
+	return nil
+}
+
+// manageBlacklist runs the blacklist subcommands, which read the blacklist ConfigMap
+// from the cache, or the environment when there is none.
+func manageBlacklist(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return fmt.Errorf("unknown blacklist command, expected test <host> [namespace]")
+	}
+	args = args[1:]
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("blacklist test takes a <host> and an optional [namespace] argument")
+	}
+	namespace := ""
+	if len(args) == 2 {
+		namespace = args[1]
+	}
+	c, err := syncedController()
+	if err != nil {
+		return err
+	}
+
+	rule, err := c.BlacklistRuleFor(args[0], namespace)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		fmt.Printf("%s is not blacklisted\n", args[0])
+		return nil
+	}
+	fmt.Printf("%s is blacklisted by rule: %s\n", args[0], rule.Entry)
+	return nil
+}
+
+// operator names the user running the command, for the notes on manual blocks.
+func operator() string {
+	if user := os.Getenv("USER"); len(user) > 0 {
+		return user
+	}
+	return "an operator"
+}
+
+func listBlockedImages(c *controller.Controller) error {
+	images, err := c.BlockedImages()
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		fmt.Println("No blocked images")
+		return nil
+	}
+
+	for i, image := range images {
+		if i > 0 {
+			fmt.Println()
+		}
+		expires := "never expires"
+		if image.ExpiresAt != nil {
+			if image.Expired(time.Now()) {
+				expires = "expired"
+			} else {
+				expires = fmt.Sprintf("expires in %s", time.Until(image.ExpiresAt.Time).Round(time.Second))
+			}
+		}
+		fmt.Printf("%s  %s  blocked %s ago, %s\n", image.Digest, image.Image, age(image.BlockedAt), expires)
+		if len(image.Note) > 0 {
+			fmt.Printf("  %s\n", image.Note)
+		}
+		if len(image.Evidence) == 0 {
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAMESPACE\tKIND\tWORKLOAD\tPOD\tCONTAINER\tRESTARTS\tLAST REASON\tEXIT CODE\tSEEN")
+		for _, evidence := range image.Evidence {
+			reason := evidence.Reason
+			if len(reason) == 0 {
+				reason = "-"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s ago\n", evidence.Namespace, evidence.Kind, evidence.Workload,
+				evidence.Pod, evidence.Container, evidence.Restarts, reason, evidence.ExitCode, age(evidence.SeenAt))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+)
+
+// flags override the configuration file and the environment
+var (
+	configPath         = flag.String("config", os.Getenv("CONFIG_PATH"), "path to the controller configuration file (env CONFIG_PATH)")
+	workers            = flag.Int("workers", 0, "number of workers per queue, overrides 'workers'")
+	maxRetries         = flag.Int("max-retries", 0, "retries before a failing key is dropped, overrides 'maxRetries'")
+	resyncPeriod       = flag.Duration("resync-period", 0, "informer resync period, overrides 'resyncPeriod'")
+	globalResyncPeriod = flag.Duration("global-resync-period", 0, "global reconcile period, overrides 'globalResyncPeriod'")
+)
+
+// applyFlags copies every flag that was set on the command line into the config.
+func applyFlags(c *config.Config) {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "workers":
+			c.Workers = *workers
+		case "max-retries":
+			c.MaxRetries = *maxRetries
+		case "resync-period":
+			c.ResyncPeriod.Duration = *resyncPeriod
+		case "global-resync-period":
+			c.GlobalResyncPeriod.Duration = *globalResyncPeriod
+		}
+	})
+}
+
+// loadConfig reads the configuration file at path, or uses only the defaults if
+// path is empty.
+func loadConfig(path string) (*config.Config, error) {
+	var data []byte
+	if len(path) > 0 {
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("Error reading configuration file: %v", err)
+		}
+	}
+	return parseConfig(data)
+}
+
+// parseConfig builds the configuration from the defaults, the configuration file,
+// the environment and the flags, in increasing order of precedence. Every invalid
+// field is reported in a single error. It is also used to parse reloaded files.
+func parseConfig(data []byte) (*config.Config, error) {
+	c, err := config.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := c.ApplyEnv()
+	applyFlags(c)
+	if verr, ok := c.Validate().(*config.ValidationError); ok {
+		errs = append(errs, verr.Errors...)
+	}
+	if len(errs) > 0 {
+		return nil, &config.ValidationError{Errors: errs}
+	}
+	return c, nil
+}
+
+// validateConfig checks a configuration file, along with any environment and flag
+// overrides, without starting the controller.
+func validateConfig(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("validate-config takes at most one [file] argument")
+	}
+	path := *configPath
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	c, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		path = "<defaults>"
+	}
+	fmt.Printf("Configuration %s (%s) is valid\n", path, c.APIVersion)
+	return nil
+}
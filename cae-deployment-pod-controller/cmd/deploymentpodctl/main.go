@@ -1,207 +1,446 @@
-package main
-
-import (
-	"flag"
-	"os"
-	"strconv"
-	"time"
-	"custom git code"
-	"k8s.io/klog"
-	deploymentconfigv1client "github.com/openshift/client-go/apps/clientset/versioned"
-	deploymentconfigv1factory "github.com/openshift/client-go/apps/informers/externalversions"
-	gocache "github.com/patrickmn/go-cache"
-	kubernetesfactory "k8s.io/client-go/informers"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/workqueue"
-	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
-	"k8s.io/client-go/kubernetes"
-)
-
-var (
-	resyncPeriod       = getEnvDuration("RESYNC_PERIOD")
-	globalResyncPeriod = getEnvDuration("GLOBAL_RESYNC_PERIOD")
-	threads            = getEnvThreads("WORKER_THREADS")
-	defaultResync      = 24 * time.Hour
-	defaultThreads     = 8
-)
-
-func initLogs() {
-	flag.Set("logtostderr", "true")
-	flag.Set("alsologtostderr", "true")
-	flag.Set("stderrthreshold", "INFO")
-	flag.Set("v", "3")
-
-	flags := flag.NewFlagSet("klog", flag.ExitOnError)
-	klog.InitFlags(flags)
-	flags.Set("logtostderr", "true")
-	flags.Set("alsologtostderr", "true")
-	flags.Set("stderrthreshold", "INFO")
-	flags.Set("v", "3")
-	flag.Parse()
-}
-
-func getDeploymentAndkubeClient() (*kubernetes.Clientset, *deploymentconfigv1client.Clientset) {
-
-	// supports passing in a local configuration path for testing purposes
-	// will return empty string if 'K8S_CONFIG_PATH' is not set, and default to SA
-	kubeConfigPath := os.Getenv("K8S_CONFIG_PATH")
-
-	// get the config object from the running pod's service account (or path)
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
-	if err != nil {
-		klog.Fatalf("Failed to obtain kubernetes configuration: %v", err)
-	}
-
-	kubeClient, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		klog.Fatalf("Error building kubernetes client: %s", err.Error())
-	}
-
-	deploymentConfigClient, err := deploymentconfigv1client.NewForConfig(config)
-	if err != nil {
-		klog.Fatalf("Error building Deployment client: %s", err.Error())
-	}
-
-	klog.Info("Successfully constructed kubernetes, deployment and pod client")
-
-	return kubeClient, deploymentConfigClient
-}
-
-func main() {
-
-	initLogs()
-
-	// expiration time of 60 minutes, purge expired items every 30 minutes
-	gocache := gocache.New(60*time.Minute, 30*time.Minute)
-
-	// get the Kubernetes client for connectivity to the API Server
-	kubeClient, deploymentConfigClient := getDeploymentAndkubeClient()
-
-	deploymentConfigInformerFactory := deploymentconfigv1factory.NewSharedInformerFactory(deploymentConfigClient, resyncPeriod)
-	kubeInformerFactory := kubernetesfactory.NewSharedInformerFactory(kubeClient, resyncPeriod)
-	//kubeInformerFactory := deploymentconfigv1factory.NewSharedInformerFactory(deploymentConfigClient, resyncPeriod)
-	deploymentConfigInformer := deploymentConfigInformerFactory.Apps().V1().DeploymentConfigs().Informer()
-	deploymentInformer := kubeInformerFactory.Apps().V1().Deployments().Informer()
-	podInformer := kubeInformerFactory.Core().V1().Pods().Informer()
-
-	namespaceLister := kubeInformerFactory.Core().V1().Namespaces().Lister() // TODO do I need to sync Lister cache too?
-
-	// create a new queue so that when the informer gets a resource that is either
-	// a result of listing or watching, we can add an idenfitying key to the queue
-	// so that it can be handled in the handler
-	deploymentconfigqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "deploymentcoinfigname")
-	deploymentqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "deploymentname")
-	podqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "podname")
-
-	deploymentConfigInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			if err == nil {
-				deploymentconfigqueue.Add(key)
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(newObj)
-			if err == nil {
-				deploymentconfigqueue.Add(key)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			if err == nil {
-				deploymentconfigqueue.Add(key)
-			}
-		},
-	}, resyncPeriod)
-
-	deploymentInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			if err == nil {
-				deploymentqueue.Add(key)
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(newObj)
-			if err == nil {
-				deploymentqueue.Add(key)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			if err == nil {
-				deploymentqueue.Add(key)
-			}
-		},
-	}, resyncPeriod)
-
-	podInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			//klog.Infof("Add Pod Key %s......", key)
-			if err == nil {
-				//klog.Infof("Adding Pod Key %s......", key)
-				podqueue.Add(key)
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(newObj)
-			//klog.Infof("Update Pod Key %s......", key)
-			if err == nil {
-				//klog.Infof("Updateing Pod Key %s......", key)
-				podqueue.Add(key)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			//klog.Infof("Delete Pod Key %s......", key)
-			if err == nil {
-				//klog.Infof("Deleting Pod Key %s......", key)
-				podqueue.Add(key)
-			}
-		},
-	}, resyncPeriod)
-
-	controller := controller.Controller{
-		DeploymentConfigClient:   deploymentConfigClient,
-		KubeClient:               kubeClient,
-		DeploymentConfigInformer: deploymentConfigInformer,
-		DeploymentInformer:       deploymentInformer,
-		PodInformer:              podInformer,
-		DeploymentConfigQueue:    deploymentconfigqueue,
-		DeploymentQueue:          deploymentqueue,
-		PodQueue:                 podqueue,
-		NamespaceLister:          namespaceLister,
-		Gocache:                  gocache,
-	}
-
-	// set up signals so we handle the first shutdown signal gracefully
-	klog.Infof("Starting Informers......")
-	stopCh := signals.SetupSignalHandler()
-	kubeInformerFactory.Start(stopCh)
-	deploymentConfigInformerFactory.Start(stopCh)
-	kubeInformerFactory.Start(stopCh)
-
-	if err := controller.Run(threads, stopCh); err != nil {
-		klog.Fatalf("Error running Deployment controller: %s", err.Error())
-	}
-}
-
-func getEnvDuration(key string) time.Duration {
-	dur, err := time.ParseDuration(os.Getenv(key))
-	if err != nil {
-		klog.Fatalf("Error loading environment variable - key: %s, err: %v", key, err)
-		return defaultResync
-	}
-	return dur
-}
-
-func getEnvThreads(key string) int {
-	vint, err := strconv.Atoi(os.Getenv(key))
-	if err != nil {
-		klog.Fatalf("Error loading environment variable - key: %s, err: %v", key, err)
-		return defaultThreads
-	}
-	return vint
-}
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	deploymentconfigv1client "github.com/openshift/client-go/apps/clientset/versioned"
+	deploymentconfigv1factory "github.com/openshift/client-go/apps/informers/externalversions"
+	routev1client "github.com/openshift/client-go/route/clientset/versioned"
+	routev1factory "github.com/openshift/client-go/route/informers/externalversions"
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/am"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	routershardv1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/routershard/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/controller"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/gslb"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/lb"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubernetesfactory "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+)
+
+func initLogs() {
+	flag.Set("logtostderr", "true")
+	flag.Set("alsologtostderr", "true")
+	flag.Set("stderrthreshold", "INFO")
+	flag.Set("v", "3")
+
+	flags := flag.NewFlagSet("klog", flag.ExitOnError)
+	klog.InitFlags(flags)
+	flags.Set("logtostderr", "true")
+	flags.Set("alsologtostderr", "true")
+	flags.Set("stderrthreshold", "INFO")
+	flags.Set("v", "3")
+	flag.Parse()
+}
+
+func getDeploymentAndkubeClient() (*kubernetes.Clientset, *deploymentconfigv1client.Clientset, *routev1client.Clientset, dynamic.Interface) {
+
+	// supports passing in a local configuration path for testing purposes
+	// will return empty string if 'K8S_CONFIG_PATH' is not set, and default to SA
+	kubeConfigPath := os.Getenv("K8S_CONFIG_PATH")
+
+	// get the config object from the running pod's service account (or path)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	if err != nil {
+		klog.Fatalf("Failed to obtain kubernetes configuration: %v", err)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Error building kubernetes client: %s", err.Error())
+	}
+
+	deploymentConfigClient, err := deploymentconfigv1client.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Error building Deployment client: %s", err.Error())
+	}
+
+	routeClient, err := routev1client.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Error building Route client: %s", err.Error())
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Error building dynamic client: %s", err.Error())
+	}
+
+	klog.Info("Successfully constructed kubernetes, deployment, route, dynamic and pod client")
+
+	return kubeClient, deploymentConfigClient, routeClient, dynamicClient
+}
+
+func main() {
+
+	initLogs()
+
+	// any arguments left after the flags select an operator subcommand
+	// instead of running the controller
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		klog.Fatalf("Error loading configuration: %v", err)
+	}
+
+	controller, startInformers := newController(cfg)
+
+	// set up signals so we handle the first shutdown signal gracefully
+	klog.Infof("Starting Informers......")
+	stopCh := signals.SetupSignalHandler()
+	startInformers(stopCh)
+
+	if err := controller.Run(cfg.Workers, stopCh); err != nil {
+		klog.Fatalf("Error running Deployment controller: %s", err.Error())
+	}
+}
+
+// newController wires up the clients, informers, queues and event handlers, and
+// returns the controller along with a function that starts the informers. It is
+// shared by the controller and the operator subcommands.
+func newController(cfg *config.Config) (*controller.Controller, func(stopCh <-chan struct{})) {
+	resyncPeriod := cfg.ResyncPeriod.Duration
+
+	// expiration time of 60 minutes, purge expired items every 30 minutes
+	gocache := gocache.New(60*time.Minute, 30*time.Minute)
+
+	// get the Kubernetes client for connectivity to the API Server
+	kubeClient, deploymentConfigClient, routeClient, dynamicClient := getDeploymentAndkubeClient()
+
+	deploymentConfigInformerFactory := deploymentconfigv1factory.NewSharedInformerFactory(deploymentConfigClient, resyncPeriod)
+	kubeInformerFactory := kubernetesfactory.NewSharedInformerFactory(kubeClient, resyncPeriod)
+	//kubeInformerFactory := deploymentconfigv1factory.NewSharedInformerFactory(deploymentConfigClient, resyncPeriod)
+	deploymentConfigInformer := deploymentConfigInformerFactory.Apps().V1().DeploymentConfigs().Informer()
+	deploymentInformer := kubeInformerFactory.Apps().V1().Deployments().Informer()
+	podInformer := kubeInformerFactory.Core().V1().Pods().Informer()
+	podInformer.AddIndexers(cache.Indexers{
+		controller.PodOwnerIndex:     controller.PodOwnerIndexFunc,
+		controller.PodNodeIndex:      controller.PodNodeIndexFunc,
+		controller.PodDebugTwinIndex: controller.PodDebugTwinIndexFunc,
+	})
+	nodeInformer := kubeInformerFactory.Core().V1().Nodes().Informer()
+	// ReplicaSets are only read, for the current revision of Deployments
+	replicaSetInformer := kubeInformerFactory.Apps().V1().ReplicaSets().Informer()
+	// HPAs are read on every step-down and restore, to hold and release them
+	hpaInformer := kubeInformerFactory.Autoscaling().V1().HorizontalPodAutoscalers().Informer()
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod)
+	quarantineInformer := dynamicInformerFactory.ForResource(quarantinev1alpha1.Resource).Informer()
+	// RouterShards are optional, without the CRD the shard2vip lookups are used alone
+	var routerShardInformer cache.SharedIndexInformer
+	if isServed(kubeClient, routershardv1alpha1.Resource) {
+		routerShardInformer = dynamicInformerFactory.ForResource(routershardv1alpha1.Resource).Informer()
+	} else {
+		klog.Info("The RouterShard CRD is not installed, router shards will only be looked up in shard2vip")
+	}
+	routeInformerFactory := routev1factory.NewSharedInformerFactory(routeClient, resyncPeriod)
+	routeInformer := routeInformerFactory.Route().V1().Routes().Informer()
+
+	namespaceLister := kubeInformerFactory.Core().V1().Namespaces().Lister() // TODO do I need to sync Lister cache too?
+
+	// the ConfigMaps with the controller's settings are watched in its own namespace only
+	var configMapInformerFactory kubernetesfactory.SharedInformerFactory
+	var configMapInformer cache.SharedIndexInformer
+	namespace := controllerNamespace()
+	if len(namespace) > 0 {
+		configMapInformerFactory = kubernetesfactory.NewSharedInformerFactoryWithOptions(kubeClient, resyncPeriod, kubernetesfactory.WithNamespace(namespace))
+		configMapInformer = configMapInformerFactory.Core().V1().ConfigMaps().Informer()
+	} else {
+		klog.Warning("POD_NAMESPACE is not set, configuration will not be reloaded")
+	}
+
+	// create a new queue so that when the informer gets a resource that is either
+	// a result of listing or watching, we can add an idenfitying key to the queue
+	// so that it can be handled in the handler
+	deploymentconfigqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "deploymentcoinfigname")
+	deploymentqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "deploymentname")
+	podqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "podname")
+	quarantinequeue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "quarantinename")
+	configmapqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "configmapname")
+	routequeue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "routename")
+	routershardqueue := workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second), "routershardname")
+
+	deploymentConfigInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err == nil {
+				deploymentconfigqueue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			if err == nil {
+				deploymentconfigqueue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				deploymentconfigqueue.Add(key)
+			}
+		},
+	}, resyncPeriod)
+
+	deploymentInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err == nil {
+				deploymentqueue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			if err == nil {
+				deploymentqueue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				deploymentqueue.Add(key)
+			}
+		},
+	}, resyncPeriod)
+
+	podInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			//klog.Infof("Add Pod Key %s......", key)
+			if err == nil {
+				//klog.Infof("Adding Pod Key %s......", key)
+				podqueue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			//klog.Infof("Update Pod Key %s......", key)
+			if err == nil {
+				//klog.Infof("Updateing Pod Key %s......", key)
+				podqueue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			//klog.Infof("Delete Pod Key %s......", key)
+			if err == nil {
+				//klog.Infof("Deleting Pod Key %s......", key)
+				podqueue.Add(key)
+			}
+		},
+	}, resyncPeriod)
+
+	quarantineInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err == nil {
+				quarantinequeue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			if err == nil {
+				quarantinequeue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				quarantinequeue.Add(key)
+			}
+		},
+	}, resyncPeriod)
+
+	routeInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err == nil {
+				routequeue.Add(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			if err == nil {
+				routequeue.Add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err == nil {
+				routequeue.Add(key)
+			}
+		},
+	}, resyncPeriod)
+
+	if routerShardInformer != nil {
+		routerShardInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				key, err := cache.MetaNamespaceKeyFunc(obj)
+				if err == nil {
+					routershardqueue.Add(key)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				key, err := cache.MetaNamespaceKeyFunc(newObj)
+				if err == nil {
+					routershardqueue.Add(key)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err == nil {
+					routershardqueue.Add(key)
+				}
+			},
+		}, resyncPeriod)
+	}
+
+	if configMapInformer != nil {
+		configMapInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				key, err := cache.MetaNamespaceKeyFunc(obj)
+				if err == nil && controller.IsWatchedConfigMap(configMapName(key)) {
+					configmapqueue.Add(key)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				key, err := cache.MetaNamespaceKeyFunc(newObj)
+				if err == nil && controller.IsWatchedConfigMap(configMapName(key)) {
+					configmapqueue.Add(key)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err == nil && controller.IsWatchedConfigMap(configMapName(key)) {
+					configmapqueue.Add(key)
+				}
+			},
+		}, resyncPeriod)
+	}
+
+	controller := controller.Controller{
+		DeploymentConfigClient:   deploymentConfigClient,
+		RouteClient:              routeClient,
+		KubeClient:               kubeClient,
+		DynamicClient:            dynamicClient,
+		DeploymentConfigInformer: deploymentConfigInformer,
+		DeploymentInformer:       deploymentInformer,
+		PodInformer:              podInformer,
+		QuarantineInformer:       quarantineInformer,
+		NodeInformer:             nodeInformer,
+		ConfigMapInformer:        configMapInformer,
+		RouteInformer:            routeInformer,
+		RouterShardInformer:      routerShardInformer,
+		ReplicaSetInformer:       replicaSetInformer,
+		HPAInformer:              hpaInformer,
+		DeploymentConfigQueue:    deploymentconfigqueue,
+		DeploymentQueue:          deploymentqueue,
+		PodQueue:                 podqueue,
+		QuarantineQueue:          quarantinequeue,
+		ConfigMapQueue:           configmapqueue,
+		RouteQueue:               routequeue,
+		RouterShardQueue:         routershardqueue,
+		NamespaceLister:          namespaceLister,
+		Gocache:                  gocache,
+		Notifier:                 controller.NewNotifier(cfg.Notifiers),
+		AddressManagement:        newAddressManagement(cfg.AddressManagement),
+		GSLB:                     newGSLB(cfg.GSLB),
+		LoadBalancer:             newLoadBalancer(cfg.LoadBalancer),
+		Recorder:                 controller.NewEventRecorder(kubeClient),
+		Config:                   cfg,
+		Namespace:                namespace,
+		ParseConfig:              parseConfig,
+	}
+
+	return &controller, func(stopCh <-chan struct{}) {
+		kubeInformerFactory.Start(stopCh)
+		deploymentConfigInformerFactory.Start(stopCh)
+		dynamicInformerFactory.Start(stopCh)
+		routeInformerFactory.Start(stopCh)
+		kubeInformerFactory.Start(stopCh)
+		if configMapInformerFactory != nil {
+			configMapInformerFactory.Start(stopCh)
+		}
+	}
+}
+
+// isServed determines if the API server serves the resource, i.e. if its CRD is
+// installed. Discovery failing otherwise is fatal, rather than running without it.
+func isServed(kubeClient kubernetes.Interface, resource schema.GroupVersionResource) bool {
+	resources, err := kubeClient.Discovery().ServerResourcesForGroupVersion(resource.GroupVersion().String())
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		klog.Fatalf("Error discovering the resources of %s: %v", resource.GroupVersion(), err)
+	}
+	for _, served := range resources.APIResources {
+		if served.Name == resource.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// newAddressManagement returns the address management client, or nil when no URL is
+// configured. The credentials come from the am-api-secret.
+func newAddressManagement(cfg config.AddressManagement) am.Client {
+	if len(cfg.URL) == 0 {
+		klog.Info("No address management URL is configured, routes will only be checked against their status")
+		return nil
+	}
+	return am.NewHTTPClient(cfg.URL, os.Getenv("AM_USERNAME"), os.Getenv("AM_PASSWORD"), cfg.Timeout.Duration)
+}
+
+// newGSLB returns the GSLB client, or nil when no URL is configured. The
+// credentials come from the gslb-api-secret.
+func newGSLB(cfg config.GSLB) gslb.Client {
+	if len(cfg.URL) == 0 {
+		klog.Info("No GSLB URL is configured, GSLB entries will not be managed")
+		return nil
+	}
+	return gslb.NewHTTPClient(cfg.URL, os.Getenv("GSLB_USERNAME"), os.Getenv("GSLB_PASSWORD"), cfg.Timeout.Duration)
+}
+
+// newLoadBalancer returns the load balancer client, or nil when no URL is
+// configured. The credentials come from the lb-api-secret.
+func newLoadBalancer(cfg config.LoadBalancer) lb.Client {
+	if len(cfg.URL) == 0 {
+		klog.Info("No load balancer URL is configured, load balancer services and monitors will not be managed")
+		return nil
+	}
+	return lb.NewHTTPClient(cfg.URL, os.Getenv("LB_USERNAME"), os.Getenv("LB_PASSWORD"), cfg.Timeout.Duration)
+}
+
+// controllerNamespace returns the namespace the controller runs in, from the
+// 'POD_NAMESPACE' env var or else the service account, or empty if neither is set.
+func controllerNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); len(namespace) > 0 {
+		return namespace
+	}
+	namespace, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(namespace))
+}
+
+// configMapName returns the name part of a ConfigMap key.
+func configMapName(key string) string {
+	_, name, _ := cache.SplitMetaNamespaceKey(key)
+	return name
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	kubernetesfactory "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+)
+
+const (
+	eventAdd    = "add"
+	eventUpdate = "update"
+	eventDelete = "delete"
+
+	kindPod              = "Pod"
+	kindDeployment       = "Deployment"
+	kindDeploymentConfig = "DeploymentConfig"
+	kindDaemonSet        = "DaemonSet"
+	kindJob              = "Job"
+	kindCronJob          = "CronJob"
+	kindReplicaSet       = "ReplicaSet"
+)
+
+// recordedEvent is one line of a recording: an informer event and the object it
+// carried, as seen by the controller.
+type recordedEvent struct {
+	Time   time.Time       `json:"time"`
+	Event  string          `json:"event"`
+	Kind   string          `json:"kind"`
+	Object json.RawMessage `json:"object"`
+}
+
+// eventRecorder writes informer events as JSON lines. Handlers of different
+// informers run concurrently, so writes are serialized.
+type eventRecorder struct {
+	lock    sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+func (r *eventRecorder) record(event, kind string, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		klog.Errorf("Error recording %s %s event: %v", kind, event, err)
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.encoder.Encode(recordedEvent{Time: time.Now().UTC(), Event: event, Kind: kind, Object: raw}); err != nil {
+		klog.Errorf("Error recording %s %s event: %v", kind, event, err)
+		return
+	}
+	r.count++
+}
+
+func (r *eventRecorder) handlers(kind string) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.record(eventAdd, kind, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			r.record(eventUpdate, kind, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.record(eventDelete, kind, obj)
+		},
+	}
+}
+
+// recordEvents captures pod and workload informer events to a JSON-lines file
+// until the process is interrupted. Besides the workloads the controller watches,
+// the DaemonSets, Jobs and CronJobs it fetches when acting on their pods, and the
+// ReplicaSets it reads Deployment revisions from, are recorded, so the simulation
+// sees them too.
+func recordEvents(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("record takes exactly one <file> argument")
+	}
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	recorder := &eventRecorder{writer: writer, encoder: json.NewEncoder(writer)}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	c, startInformers := newController(cfg)
+	c.PodInformer.AddEventHandler(recorder.handlers(kindPod))
+	c.DeploymentInformer.AddEventHandler(recorder.handlers(kindDeployment))
+	c.DeploymentConfigInformer.AddEventHandler(recorder.handlers(kindDeploymentConfig))
+	c.ReplicaSetInformer.AddEventHandler(recorder.handlers(kindReplicaSet))
+	ownerInformerFactory := kubernetesfactory.NewSharedInformerFactory(c.KubeClient, 0)
+	ownerInformerFactory.Apps().V1().DaemonSets().Informer().AddEventHandler(recorder.handlers(kindDaemonSet))
+	ownerInformerFactory.Batch().V1().Jobs().Informer().AddEventHandler(recorder.handlers(kindJob))
+	ownerInformerFactory.Batch().V1beta1().CronJobs().Informer().AddEventHandler(recorder.handlers(kindCronJob))
+
+	stopCh := signals.SetupSignalHandler()
+	startInformers(stopCh)
+	ownerInformerFactory.Start(stopCh)
+	fmt.Fprintf(os.Stderr, "Recording pod and workload events to %s, interrupt to stop\n", args[0])
+	<-stopCh
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	fmt.Fprintf(os.Stderr, "Recorded %d events\n", recorder.count)
+	return writer.Flush()
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	deploymentconfigfake "github.com/openshift/client-go/apps/clientset/versioned/fake"
+	deploymentconfigv1factory "github.com/openshift/client-go/apps/informers/externalversions"
+	gocache "github.com/patrickmn/go-cache"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/controller"
+	dv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubernetesfactory "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	podResource              = v1.SchemeGroupVersion.WithResource("pods")
+	deploymentResource       = dv1.SchemeGroupVersion.WithResource("deployments")
+	deploymentConfigResource = dcv1.SchemeGroupVersion.WithResource("deploymentconfigs")
+	daemonSetResource        = dv1.SchemeGroupVersion.WithResource("daemonsets")
+	replicaSetResource       = dv1.SchemeGroupVersion.WithResource("replicasets")
+	jobResource              = batchv1.SchemeGroupVersion.WithResource("jobs")
+	cronJobResource          = batchv1beta1.SchemeGroupVersion.WithResource("cronjobs")
+)
+
+// simulatedQueue is a work queue whose keys added with AddAfter or AddRateLimited
+// become due on the simulation's clock instead of the wall clock, so a step-down
+// due an hour after an event is processed once the recording reaches that hour.
+type simulatedQueue struct {
+	workqueue.Interface
+	workqueue.RateLimiter
+	clock   clock.Clock
+	waiting map[interface{}]time.Time
+}
+
+func newSimulatedQueue(clock clock.Clock) *simulatedQueue {
+	return &simulatedQueue{
+		Interface:   workqueue.New(),
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 300*time.Second),
+		clock:       clock,
+		waiting:     map[interface{}]time.Time{},
+	}
+}
+
+func (q *simulatedQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	due := q.clock.Now().Add(duration)
+	if waiting, exists := q.waiting[item]; !exists || due.Before(waiting) {
+		q.waiting[item] = due
+	}
+}
+
+func (q *simulatedQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.When(item))
+}
+
+// promote adds the waiting keys that are due by the clock's time, in the order they
+// became due.
+func (q *simulatedQueue) promote() {
+	now := q.clock.Now()
+	var due []interface{}
+	for item, at := range q.waiting {
+		if !at.After(now) {
+			due = append(due, item)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if at := q.waiting[due[i]]; !at.Equal(q.waiting[due[j]]) {
+			return at.Before(q.waiting[due[j]])
+		}
+		return fmt.Sprint(due[i]) < fmt.Sprint(due[j])
+	})
+	for _, item := range due {
+		delete(q.waiting, item)
+		q.Add(item)
+	}
+}
+
+// simulation replays recorded events through the same decision code as UpdatePod,
+// and processes the keys the controller queues as its workers would. The controller
+// is backed by fake clients, and its informer caches are fed directly from the
+// recording instead of being started, so nothing touches a cluster. Its clock
+// follows the timestamps of the recording.
+type simulation struct {
+	controller             *controller.Controller
+	clock                  *clock.FakeClock
+	queues                 []*simulatedQueue
+	kubeClient             *kubefake.Clientset
+	deploymentConfigClient *deploymentconfigfake.Clientset
+	dynamicClient          *dynamicfake.FakeDynamicClient
+
+	events   map[string]int
+	actions  map[string]int
+	affected map[string]struct{}
+	pods     int
+	acted    int
+	failed   int
+}
+
+// generateName fills in the name of created objects that only set generateName,
+// as the API server would. Returning false lets the default reactor store it.
+func generateName(action clienttesting.Action) (bool, runtime.Object, error) {
+	create, ok := action.(clienttesting.CreateAction)
+	if !ok {
+		return false, nil, nil
+	}
+	meta, err := apimeta.Accessor(create.GetObject())
+	if err == nil && len(meta.GetName()) == 0 && len(meta.GetGenerateName()) > 0 {
+		meta.SetName(meta.GetGenerateName() + utilrand.String(5))
+	}
+	return false, nil, nil
+}
+
+func newSimulation(cfg *config.Config) *simulation {
+	kubeClient := kubefake.NewSimpleClientset()
+	deploymentConfigClient := deploymentconfigfake.NewSimpleClientset()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	for _, fake := range []*clienttesting.Fake{&kubeClient.Fake, &deploymentConfigClient.Fake, &dynamicClient.Fake} {
+		fake.PrependReactor("create", "*", generateName)
+	}
+
+	kubeInformerFactory := kubernetesfactory.NewSharedInformerFactory(kubeClient, 0)
+	deploymentConfigInformerFactory := deploymentconfigv1factory.NewSharedInformerFactory(deploymentConfigClient, 0)
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	podInformer := kubeInformerFactory.Core().V1().Pods().Informer()
+	podInformer.AddIndexers(cache.Indexers{
+		controller.PodOwnerIndex:     controller.PodOwnerIndexFunc,
+		controller.PodNodeIndex:      controller.PodNodeIndexFunc,
+		controller.PodDebugTwinIndex: controller.PodDebugTwinIndexFunc,
+	})
+
+	simulatedClock := clock.NewFakeClock(time.Time{})
+	var queues []*simulatedQueue
+	newQueue := func() workqueue.RateLimitingInterface {
+		queue := newSimulatedQueue(simulatedClock)
+		queues = append(queues, queue)
+		return queue
+	}
+
+	c := &controller.Controller{
+		DeploymentConfigClient:   deploymentConfigClient,
+		KubeClient:               kubeClient,
+		DynamicClient:            dynamicClient,
+		DeploymentConfigInformer: deploymentConfigInformerFactory.Apps().V1().DeploymentConfigs().Informer(),
+		DeploymentInformer:       kubeInformerFactory.Apps().V1().Deployments().Informer(),
+		PodInformer:              podInformer,
+		QuarantineInformer:       dynamicInformerFactory.ForResource(quarantinev1alpha1.Resource).Informer(),
+		NodeInformer:             kubeInformerFactory.Core().V1().Nodes().Informer(),
+		ReplicaSetInformer:       kubeInformerFactory.Apps().V1().ReplicaSets().Informer(),
+		DeploymentConfigQueue:    newQueue(),
+		DeploymentQueue:          newQueue(),
+		PodQueue:                 newQueue(),
+		QuarantineQueue:          newQueue(),
+		NamespaceLister:          kubeInformerFactory.Core().V1().Namespaces().Lister(),
+		Gocache:                  gocache.New(60*time.Minute, 30*time.Minute),
+		Notifier:                 controller.LogNotifier{},
+		Config:                   cfg,
+		Clock:                    simulatedClock,
+	}
+
+	return &simulation{
+		controller:             c,
+		clock:                  simulatedClock,
+		queues:                 queues,
+		kubeClient:             kubeClient,
+		deploymentConfigClient: deploymentConfigClient,
+		dynamicClient:          dynamicClient,
+		events:                 map[string]int{},
+		actions:                map[string]int{},
+		affected:               map[string]struct{}{},
+	}
+}
+
+// store applies an event to an informer cache and to the fake client's tracker,
+// so the controller sees the object both from its listers and through the API.
+// Objects the controller has no informer for only go to the tracker, with a nil
+// indexer.
+func store(indexer cache.Indexer, tracker clienttesting.ObjectTracker, resource schema.GroupVersionResource, event string, obj runtime.Object) error {
+	meta, err := apimeta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+
+	if event == eventDelete {
+		tracker.Delete(resource, meta.GetNamespace(), meta.GetName())
+		if indexer == nil {
+			return nil
+		}
+		return indexer.Delete(obj)
+	}
+	if err := tracker.Update(resource, obj, meta.GetNamespace()); err != nil {
+		if err := tracker.Create(resource, obj, meta.GetNamespace()); err != nil {
+			return err
+		}
+	}
+	if indexer == nil {
+		return nil
+	}
+	return indexer.Update(obj)
+}
+
+// enqueue adds the key of the object to the queue, as the informer's event handler
+// would.
+func enqueue(queue workqueue.RateLimitingInterface, obj runtime.Object) {
+	if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+		queue.Add(key)
+	}
+}
+
+// replay applies one recorded event, and for pods runs it through UpdatePod.
+// Workload events queue the workload like the informers do.
+func (s *simulation) replay(event recordedEvent) error {
+	s.events[fmt.Sprintf("%s %s", event.Kind, event.Event)]++
+
+	c := s.controller
+	switch event.Kind {
+	case kindDeployment:
+		deployment := &dv1.Deployment{}
+		if err := json.Unmarshal(event.Object, deployment); err != nil {
+			return err
+		}
+		if err := store(c.DeploymentInformer.GetIndexer(), s.kubeClient.Tracker(), deploymentResource, event.Event, deployment); err != nil {
+			return err
+		}
+		enqueue(c.DeploymentQueue, deployment)
+		return nil
+	case kindDeploymentConfig:
+		deploymentconfig := &dcv1.DeploymentConfig{}
+		if err := json.Unmarshal(event.Object, deploymentconfig); err != nil {
+			return err
+		}
+		if err := store(c.DeploymentConfigInformer.GetIndexer(), s.deploymentConfigClient.Tracker(), deploymentConfigResource, event.Event, deploymentconfig); err != nil {
+			return err
+		}
+		enqueue(c.DeploymentConfigQueue, deploymentconfig)
+		return nil
+	case kindDaemonSet:
+		daemonset := &dv1.DaemonSet{}
+		if err := json.Unmarshal(event.Object, daemonset); err != nil {
+			return err
+		}
+		return store(nil, s.kubeClient.Tracker(), daemonSetResource, event.Event, daemonset)
+	case kindReplicaSet:
+		replicaset := &dv1.ReplicaSet{}
+		if err := json.Unmarshal(event.Object, replicaset); err != nil {
+			return err
+		}
+		return store(c.ReplicaSetInformer.GetIndexer(), s.kubeClient.Tracker(), replicaSetResource, event.Event, replicaset)
+	case kindJob:
+		job := &batchv1.Job{}
+		if err := json.Unmarshal(event.Object, job); err != nil {
+			return err
+		}
+		return store(nil, s.kubeClient.Tracker(), jobResource, event.Event, job)
+	case kindCronJob:
+		cronjob := &batchv1beta1.CronJob{}
+		if err := json.Unmarshal(event.Object, cronjob); err != nil {
+			return err
+		}
+		return store(nil, s.kubeClient.Tracker(), cronJobResource, event.Event, cronjob)
+	case kindPod:
+		pod := &v1.Pod{}
+		if err := json.Unmarshal(event.Object, pod); err != nil {
+			return err
+		}
+		if err := store(c.PodInformer.GetIndexer(), s.kubeClient.Tracker(), podResource, event.Event, pod); err != nil {
+			return err
+		}
+		if event.Event == eventDelete {
+			return nil
+		}
+
+		s.pods++
+		decision, err := c.Decide(pod)
+		if err != nil {
+			return err
+		}
+		if decision.Act {
+			s.acted++
+		}
+		return c.UpdatePod(pod)
+	}
+	return fmt.Errorf("unknown kind %q", event.Kind)
+}
+
+// collect prints the writes the controller made through the fake clients since the
+// last call, and feeds the written objects back into the informer caches as the
+// watches would have.
+func (s *simulation) collect(at time.Time) {
+	fakes := []*clienttesting.Fake{&s.kubeClient.Fake, &s.deploymentConfigClient.Fake, &s.dynamicClient.Fake}
+	for _, fake := range fakes {
+		for _, action := range fake.Actions() {
+			verb, resource := action.GetVerb(), action.GetResource().Resource
+			if verb != "create" && verb != "update" && verb != "patch" && verb != "delete" {
+				continue
+			}
+
+			name := ""
+			var obj runtime.Object
+			switch a := action.(type) {
+			case clienttesting.CreateAction:
+				obj = a.GetObject()
+			case clienttesting.UpdateAction:
+				obj = a.GetObject()
+			case clienttesting.DeleteAction:
+				name = a.GetName()
+			case clienttesting.PatchAction:
+				name = a.GetName()
+			}
+			if meta, err := apimeta.Accessor(obj); obj != nil && err == nil {
+				name = meta.GetName()
+			}
+			if len(action.GetSubresource()) > 0 {
+				resource = fmt.Sprintf("%s/%s", resource, action.GetSubresource())
+			}
+
+			fmt.Printf("%s  %-6s %s %s/%s\n", at.Format(time.RFC3339), verb, resource, action.GetNamespace(), name)
+			s.actions[fmt.Sprintf("%s %s", verb, resource)]++
+			s.affected[fmt.Sprintf("%s/%s", action.GetNamespace(), name)] = struct{}{}
+
+			s.feedBack(action.GetResource().Resource, verb, obj)
+		}
+		fake.ClearActions()
+	}
+}
+
+// feedBack updates the informer cache with an object the controller wrote, and
+// queues workloads and Quarantines as their informers' event handlers would.
+func (s *simulation) feedBack(resource, verb string, obj runtime.Object) {
+	if obj == nil || (verb != "create" && verb != "update") {
+		return
+	}
+
+	c := s.controller
+	var indexer cache.Indexer
+	var queue workqueue.RateLimitingInterface
+	switch resource {
+	case deploymentResource.Resource:
+		indexer, queue = c.DeploymentInformer.GetIndexer(), c.DeploymentQueue
+	case deploymentConfigResource.Resource:
+		indexer, queue = c.DeploymentConfigInformer.GetIndexer(), c.DeploymentConfigQueue
+	case podResource.Resource:
+		indexer = c.PodInformer.GetIndexer()
+	case quarantinev1alpha1.Resource.Resource:
+		indexer, queue = c.QuarantineInformer.GetIndexer(), c.QuarantineQueue
+	default:
+		return
+	}
+	indexer.Update(obj)
+	if queue != nil {
+		enqueue(queue, obj)
+	}
+}
+
+// advance moves the simulation's clock forward to the time, never back, and
+// processes every key queued or due by then, printing the writes made.
+func (s *simulation) advance(to time.Time) {
+	if to.After(s.clock.Now()) {
+		s.clock.SetTime(to)
+	}
+	for {
+		for _, queue := range s.queues {
+			queue.promote()
+		}
+		if s.controller.ProcessQueued() == 0 {
+			return
+		}
+		s.collect(s.clock.Now())
+	}
+}
+
+// summary prints statistics about the replay.
+func (s *simulation) summary() {
+	printCounts := func(title string, counts map[string]int) {
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Printf("%s:\n", title)
+		for _, key := range keys {
+			fmt.Printf("  %-40s %d\n", key, counts[key])
+		}
+	}
+
+	fmt.Println("\nSummary")
+	printCounts("Events replayed", s.events)
+	fmt.Printf("Pods evaluated: %d\nDecisions to act: %d\nErrors: %d\n", s.pods, s.acted, s.failed)
+	printCounts("Actions", s.actions)
+	fmt.Printf("Objects written: %d\n", len(s.affected))
+}
+
+// simulateEvents replays a recording made with 'record' through the controller's
+// decision code against fake clients, printing every action it would have taken.
+func simulateEvents(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("simulate takes exactly one <file> argument")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	s := newSimulation(cfg)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		event := recordedEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		s.advance(event.Time)
+		if err := s.replay(event); err != nil {
+			s.failed++
+			fmt.Printf("%s  error  line %d: %v\n", event.Time.Format(time.RFC3339), line, err)
+		}
+		s.collect(event.Time)
+		s.advance(event.Time)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.summary()
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/webhook"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+)
+
+// controllerUser returns the username of the controller's service account, which
+// the webhook must let through so it can restore quarantined workloads. The webhook
+// runs under the same service account, from the downward API.
+func controllerUser() []string {
+	namespace, serviceAccount := controllerNamespace(), os.Getenv("SERVICE_ACCOUNT")
+	if len(namespace) == 0 || len(serviceAccount) == 0 {
+		klog.Warning("POD_NAMESPACE or SERVICE_ACCOUNT is not set, the controller's own updates are validated too")
+		return nil
+	}
+	return []string{fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount)}
+}
+
+// runWebhook serves the admission webhook until the process is signalled. It uses
+// the same informer caches as the controller to look up workloads and Quarantines.
+func runWebhook(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("webhook takes no arguments")
+	}
+	c, err := syncedController()
+	if err != nil {
+		return err
+	}
+
+	server, err := webhook.NewServer(c, c.Config.Webhook.CertDir, controllerUser()...)
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServe(c.Config.Webhook.Address, signals.SetupSignalHandler())
+}
@@ -0,0 +1,29 @@
+// Package am is the client of address management (AM), which holds the DNS CNAME
+// aliases pointing route hosts at the reverse proxy (RP) of their router shard.
+package am
+
+import "strings"
+
+// Client gets and moves the CNAME aliases of route hosts.
+type Client interface {
+	// GetAlias returns the RP the cname is an alias of, with a trailing '.', or an
+	// empty string if address management has no alias for it
+	GetAlias(cname string) (string, error)
+	// MoveAlias makes the cname an alias of the RP, creating the alias if needed
+	MoveAlias(cname, rp string) error
+}
+
+// Alias is a CNAME alias as exchanged with the address management API.
+type Alias struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+// CanonicalRP returns the RP with the trailing '.' of the AM responses, so it can be
+// compared with the lookups, e.g. "my-infra-vip.cisco.com.".
+func CanonicalRP(rp string) string {
+	if len(rp) == 0 {
+		return rp
+	}
+	return strings.TrimSuffix(rp, ".") + "."
+}
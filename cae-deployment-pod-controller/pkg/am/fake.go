@@ -0,0 +1,92 @@
+package am
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory address management. It implements Client directly, and its
+// Handler serves the same REST API as the real one, so HTTPClient can be run against
+// it with httptest.NewServer.
+type Fake struct {
+	// Username and Password, when set, are the basic auth credentials the Handler
+	// accepts, like the AM_USERNAME and AM_PASSWORD the controller logs in with
+	Username string
+	Password string
+
+	lock    sync.Mutex
+	aliases map[string]string
+	moves   int
+}
+
+// NewFake returns a fake holding the aliases, by cname.
+func NewFake(aliases map[string]string) *Fake {
+	f := &Fake{aliases: map[string]string{}}
+	for cname, rp := range aliases {
+		f.aliases[cname] = CanonicalRP(rp)
+	}
+	return f
+}
+
+// GetAlias returns the RP the cname is an alias of.
+func (f *Fake) GetAlias(cname string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.aliases[cname], nil
+}
+
+// MoveAlias points the cname at the RP.
+func (f *Fake) MoveAlias(cname, rp string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.aliases[cname] = CanonicalRP(rp)
+	f.moves++
+	return nil
+}
+
+// Moves returns how many times an alias was moved.
+func (f *Fake) Moves() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.moves
+}
+
+// Handler serves the aliases over the address management REST API.
+func (f *Fake) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(f.Username) > 0 || len(f.Password) > 0 {
+			if username, password, ok := r.BasicAuth(); !ok || username != f.Username || password != f.Password {
+				http.Error(w, "invalid credentials", http.StatusUnauthorized)
+				return
+			}
+		}
+		if !strings.HasPrefix(r.URL.Path, aliasesPath) || len(r.URL.Path) == len(aliasesPath) {
+			http.NotFound(w, r)
+			return
+		}
+		cname := strings.TrimPrefix(r.URL.Path, aliasesPath)
+
+		switch r.Method {
+		case http.MethodGet:
+			rp, _ := f.GetAlias(cname)
+			if len(rp) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(Alias{Name: cname, Target: rp})
+		case http.MethodPut:
+			alias := Alias{}
+			if err := json.NewDecoder(r.Body).Decode(&alias); err != nil || len(alias.Target) == 0 {
+				http.Error(w, "invalid alias", http.StatusBadRequest)
+				return
+			}
+			f.MoveAlias(cname, alias.Target)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package am
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/httpapi"
+)
+
+// aliasesPath is where the API serves the aliases, by cname
+const aliasesPath = "/aliases/"
+
+// HTTPClient talks to the address management REST API with basic auth.
+type HTTPClient struct {
+	*httpapi.Client
+}
+
+// NewHTTPClient returns a client of the address management API at url, logging in
+// with basic auth. A lookup or move that takes longer than the timeout fails.
+func NewHTTPClient(url, username, password string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{httpapi.NewClient("address management", url, timeout, httpapi.BasicAuth(username, password))}
+}
+
+// GetAlias returns the RP the cname is an alias of, or an empty string when the API
+// does not know the cname.
+func (c *HTTPClient) GetAlias(cname string) (string, error) {
+	resp, err := c.Do(http.MethodGet, aliasPath(cname), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err := httpapi.CheckStatus(resp, "Error getting alias of cname %s from address management", cname); err != nil {
+		return "", err
+	}
+	alias := Alias{}
+	if err := json.NewDecoder(resp.Body).Decode(&alias); err != nil {
+		return "", fmt.Errorf("Error decoding alias of cname %s from address management: %v", cname, err)
+	}
+	return CanonicalRP(alias.Target), nil
+}
+
+// MoveAlias points the cname at the RP.
+func (c *HTTPClient) MoveAlias(cname, rp string) error {
+	body, err := json.Marshal(Alias{Name: cname, Target: CanonicalRP(rp)})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(http.MethodPut, aliasPath(cname), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return httpapi.CheckStatus(resp, "Error moving alias of cname %s in address management", cname)
+}
+
+// aliasPath returns the path of the alias of the cname.
+func aliasPath(cname string) string {
+	return aliasesPath + url.PathEscape(cname)
+}
@@ -0,0 +1,36 @@
+package am
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+)
+
+func TestHTTPClientAgainstFake(t *testing.T) {
+	fake := NewFake(map[string]string{"app.cisco.com": "rp-a.cisco.com"})
+	fake.Username, fake.Password = "user", "secret"
+	server := httptest.NewServer(fake.Handler())
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "user", "secret", time.Second)
+	if rp, err := client.GetAlias("app.cisco.com"); err != nil || rp != "rp-a.cisco.com." {
+		t.Fatalf("GetAlias() = %q, %v, want rp-a.cisco.com.", rp, err)
+	}
+	if rp, err := client.GetAlias("unknown.cisco.com"); err != nil || rp != "" {
+		t.Fatalf("GetAlias() of an unknown cname = %q, %v, want no alias", rp, err)
+	}
+	if err := client.MoveAlias("app.cisco.com", "rp-b.cisco.com"); err != nil {
+		t.Fatalf("MoveAlias() = %v", err)
+	}
+	if rp, _ := fake.GetAlias("app.cisco.com"); rp != "rp-b.cisco.com." || fake.Moves() != 1 {
+		t.Errorf("after MoveAlias() the alias is %q after %d moves, want rp-b.cisco.com. after 1", rp, fake.Moves())
+	}
+
+	client = NewHTTPClient(server.URL, "user", "wrong", time.Second)
+	_, err := client.GetAlias("app.cisco.com")
+	if _, nonRetryable := err.(*errortypes.NonRetryableError); !nonRetryable {
+		t.Errorf("GetAlias() with bad credentials = %v, want a non-retryable error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the API group of the controller's custom resources
+	GroupName = "xxx.xxx.com"
+	// Version is the API version of the Quarantine resource
+	Version = "v1alpha1"
+	// Kind is the kind of the Quarantine resource
+	Kind = "Quarantine"
+
+	// Finalizer is added to every Quarantine so that deleting it restores the
+	// workload before the object goes away.
+	Finalizer = "xxx.xxx.com/restore-workload"
+
+	// ApprovalAnnotation is set on a Pending Quarantine to 'approved' or 'rejected'
+	ApprovalAnnotation = "xxx.xxx.com/approval"
+	// ApprovedByAnnotation names who set the approval annotation. It is set by the
+	// admission webhook from the user making the request, never by the user.
+	ApprovedByAnnotation = "xxx.xxx.com/approved-by"
+
+	// PhasePending means the remediation is proposed and waiting for approval
+	PhasePending = "Pending"
+	// PhaseActive means the remediation is in effect on the workload
+	PhaseActive = "Active"
+	// PhaseRejected means the proposed remediation was rejected and never applied
+	PhaseRejected = "Rejected"
+	// PhaseReleased means the workload has been restored
+	PhaseReleased = "Released"
+
+	// ConditionApproved is True once a proposed remediation is approved, and False
+	// once it is rejected
+	ConditionApproved = "Approved"
+	// ConditionQuarantined is True while the remediation is in effect
+	ConditionQuarantined = "Quarantined"
+	// ConditionRestored is True once the workload has been restored
+	ConditionRestored = "Restored"
+)
+
+var (
+	// SchemeGroupVersion is the group version used to register the Quarantine resource
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+	// Resource is the group version resource used with the dynamic client
+	Resource = SchemeGroupVersion.WithResource("quarantines")
+)
+
+// Quarantine records a single remediation the controller applied to a workload. It
+// lives in the workload's namespace. Deleting it, or setting spec.release, restores
+// the workload.
+type Quarantine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuarantineSpec   `json:"spec"`
+	Status QuarantineStatus `json:"status,omitempty"`
+}
+
+// WorkloadReference identifies the quarantined workload in the Quarantine's namespace.
+type WorkloadReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// QuarantineSpec describes what was done to the workload and why.
+type QuarantineSpec struct {
+	Workload WorkloadReference `json:"workload"`
+	Reason   string            `json:"reason"`
+	Action   string            `json:"action"`
+
+	// OriginalState holds the workload settings saved before the remediation,
+	// keyed by the annotation they are stored under on the workload.
+	OriginalState map[string]string `json:"originalState,omitempty"`
+
+	// Release restores the workload while keeping the Quarantine for history.
+	Release bool `json:"release,omitempty"`
+}
+
+// QuarantineStatus is the observed state of the Quarantine.
+type QuarantineStatus struct {
+	Phase         string                `json:"phase,omitempty"`
+	ApprovedBy    string                `json:"approvedBy,omitempty"`
+	DecidedAt     *metav1.Time          `json:"decidedAt,omitempty"`
+	QuarantinedAt *metav1.Time          `json:"quarantinedAt,omitempty"`
+	ReleasedAt    *metav1.Time          `json:"releasedAt,omitempty"`
+	Conditions    []QuarantineCondition `json:"conditions,omitempty"`
+
+	// Replicas and CrashLooping count the pods of the workload, as last seen
+	// by the workload reconciler.
+	Replicas     int32 `json:"replicas,omitempty"`
+	CrashLooping int32 `json:"crashLooping,omitempty"`
+}
+
+// QuarantineCondition describes one aspect of the Quarantine's state.
+type QuarantineCondition struct {
+	Type               string             `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	Reason             string             `json:"reason,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime,omitempty"`
+}
+
+// SetCondition adds the condition, or updates it in place if one of the same type
+// exists. The transition time only moves when the status changes.
+func (s *QuarantineStatus) SetCondition(condition QuarantineCondition) {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type != condition.Type {
+			continue
+		}
+		if s.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = s.Conditions[i].LastTransitionTime
+		}
+		s.Conditions[i] = condition
+		return
+	}
+	s.Conditions = append(s.Conditions, condition)
+}
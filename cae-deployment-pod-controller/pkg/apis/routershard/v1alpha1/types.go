@@ -0,0 +1,95 @@
+package v1alpha1
+
+import (
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the API group of the controller's custom resources
+	GroupName = quarantinev1alpha1.GroupName
+	// Version is the API version of the RouterShard resource
+	Version = "v1alpha1"
+	// Kind is the kind of the RouterShard resource
+	Kind = "RouterShard"
+
+	// ConditionValid is True when the spec is valid, and False with the validation
+	// errors as the message when it is not
+	ConditionValid = "Valid"
+	// ConditionActive is True while the RouterShard is the one the lookups use for
+	// its shard
+	ConditionActive = "Active"
+)
+
+var (
+	// SchemeGroupVersion is the group version used to register the RouterShard resource
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+	// Resource is the group version resource used with the dynamic client
+	Resource = SchemeGroupVersion.WithResource("routershards")
+)
+
+// RouterShard maps a router shard to the reverse proxy (RP) its routes should be
+// on. Projects select their shard with the 'router' label. It is cluster-scoped.
+// Several RouterShards may list the same shard, for different datacenters or with
+// different weights; the enabled one for the local datacenter with the highest
+// weight is used.
+type RouterShard struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RouterShardSpec   `json:"spec"`
+	Status RouterShardStatus `json:"status,omitempty"`
+}
+
+// RouterShardSpec describes the shard and its RP.
+type RouterShardSpec struct {
+	// Shard is the router shard name, the value of the projects' 'router' label
+	Shard string `json:"shard"`
+	// RP is the hostname of the RP (VIP) of the shard, e.g. "my-infra-vip.cisco.com"
+	RP string `json:"rp"`
+	// Datacenter is the datacenter of the RP; empty applies to every datacenter
+	Datacenter string `json:"datacenter,omitempty"`
+	// Weight ranks RouterShards of the same shard and datacenter, highest first
+	Weight int32 `json:"weight,omitempty"`
+	// Enabled takes the RouterShard out of the lookups when false, defaulting to true
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// IsEnabled reports whether the RouterShard may be used by the lookups.
+func (s *RouterShardSpec) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// RouterShardStatus is the observed state of the RouterShard.
+type RouterShardStatus struct {
+	// ObservedGeneration is the generation of the spec the conditions describe
+	ObservedGeneration int64                  `json:"observedGeneration,omitempty"`
+	Conditions         []RouterShardCondition `json:"conditions,omitempty"`
+}
+
+// RouterShardCondition describes one aspect of the RouterShard's state.
+type RouterShardCondition struct {
+	Type               string             `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	Reason             string             `json:"reason,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime,omitempty"`
+}
+
+// SetCondition adds the condition, or updates it in place if one of the same type
+// exists. The transition time only moves when the status changes.
+func (s *RouterShardStatus) SetCondition(condition RouterShardCondition) {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type != condition.Type {
+			continue
+		}
+		if s.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = s.Conditions[i].LastTransitionTime
+		}
+		s.Conditions[i] = condition
+		return
+	}
+	s.Conditions = append(s.Conditions, condition)
+}
@@ -0,0 +1,588 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// APIVersion is the only supported version of the configuration file
+	APIVersion = "xxx.xxx.com/v1alpha1"
+	// Kind is the kind of the configuration file
+	Kind = "DeploymentPodControllerConfig"
+
+	// ActionScale steps replicas down, ActionPause freezes rollouts and triggers
+	// while leaving the running replicas alone, ActionBoth does both.
+	ActionScale = "scale"
+	ActionPause = "pause"
+	ActionBoth  = "both"
+
+	// ScaleZero scales straight to the floor, ScaleHalve halves the replicas on
+	// every step and ScaleStep removes a fixed number per step.
+	ScaleZero  = "zero"
+	ScaleHalve = "halve"
+	ScaleStep  = "step"
+
+	// DebugTwinDisabled never creates twins, DebugTwinBefore creates a twin and then
+	// remediates as usual, DebugTwinInstead creates a twin and leaves the workload alone.
+	DebugTwinDisabled = "disabled"
+	DebugTwinBefore   = "before"
+	DebugTwinInstead  = "instead"
+
+	// NodeActionDisabled leaves nodes alone and never blames them, NodeActionCordon
+	// cordons and NodeActionTaint taints nodes blamed for crash loops.
+	NodeActionDisabled = "disabled"
+	NodeActionCordon   = "cordon"
+	NodeActionTaint    = "taint"
+
+	// ImageActionDisabled ignores image digests, ImageActionWarn warns about pods
+	// running a blocked digest and ImageActionAct also acts on their workloads.
+	ImageActionDisabled = "disabled"
+	ImageActionWarn     = "warn"
+	ImageActionAct      = "act"
+
+	// AdmissionDisabled, AdmissionWarn and AdmissionDeny are what the admission
+	// webhook does with workloads that reference a blocked image.
+	AdmissionDisabled = "disabled"
+	AdmissionWarn     = "warn"
+	AdmissionDeny     = "deny"
+
+	// Approved and Rejected are the decisions that can apply when an approval times out
+	Approved = "approved"
+	Rejected = "rejected"
+)
+
+// Config is the versioned configuration file of the controller. Every field has
+// a default, so an empty file (or none at all) is valid.
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// ResyncPeriod is how often informers resync every object
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// GlobalResyncPeriod is how often the global watcher reconciles everything
+	GlobalResyncPeriod metav1.Duration `json:"globalResyncPeriod"`
+	// Workers is the number of workers per queue
+	Workers int `json:"workers"`
+	// MaxRetries is how many times a failing key is requeued before it is dropped
+	MaxRetries int `json:"maxRetries"`
+
+	Policy     Policy      `json:"policy"`
+	Routes     RoutePolicy `json:"routes"`
+	Notifiers  Notifiers   `json:"notifiers"`
+	Guardrails Guardrails  `json:"guardrails"`
+	Webhook    Webhook     `json:"webhook"`
+
+	AddressManagement AddressManagement `json:"addressManagement"`
+	GSLB              GSLB              `json:"gslb"`
+	LoadBalancer      LoadBalancer      `json:"loadBalancer"`
+	Metrics           Metrics           `json:"metrics"`
+}
+
+// Policy decides when and how the controller remediates crash-looping workloads.
+type Policy struct {
+	// WatchedNamespaces are the namespaces the controller acts in
+	WatchedNamespaces []string `json:"watchedNamespaces"`
+	// RestartThreshold is the restart count above which a pod is crash-looping
+	RestartThreshold int32 `json:"restartThreshold"`
+	// Quorum is how many replicas must be crash-looping before acting
+	Quorum QuorumPolicy `json:"quorum"`
+	// Action is one of scale, pause or both
+	Action string `json:"action"`
+
+	Scale     ScalePolicy     `json:"scale"`
+	Approval  ApprovalPolicy  `json:"approval"`
+	DebugTwin DebugTwinPolicy `json:"debugTwin"`
+	Node      NodePolicy      `json:"node"`
+	Images    ImagePolicy     `json:"images"`
+}
+
+// QuorumPolicy keeps a single bad replica, e.g. on a bad node, from triggering an
+// action on the whole workload. The controller acts when at least MinReplicas, or
+// at least Percent of the pods of the current revision are crash-looping. Setting
+// either to zero disables that half of the rule.
+type QuorumPolicy struct {
+	MinReplicas int32 `json:"minReplicas"`
+	Percent     int32 `json:"percent"`
+}
+
+// ScalePolicy configures progressive step-down scaling.
+type ScalePolicy struct {
+	Strategy string          `json:"strategy"`
+	Step     int32           `json:"step"`
+	Floor    int32           `json:"floor"`
+	Interval metav1.Duration `json:"interval"`
+}
+
+// ApprovalPolicy configures which namespaces need a human to approve actions.
+type ApprovalPolicy struct {
+	Namespaces      []string        `json:"namespaces"`
+	Timeout         metav1.Duration `json:"timeout"`
+	TimeoutDecision string          `json:"timeoutDecision"`
+}
+
+// DebugTwinPolicy configures the sleeping copies of crashing pods.
+type DebugTwinPolicy struct {
+	Mode       string          `json:"mode"`
+	Command    []string        `json:"command"`
+	TTL        metav1.Duration `json:"ttl"`
+	GCInterval metav1.Duration `json:"gcInterval"`
+}
+
+// NodePolicy configures blaming nodes rather than workloads for crash loops. A node
+// is blamed when MinWorkloads unrelated workloads crash-loop on it, or two of them
+// if the node reports an adverse condition such as disk pressure. The workloads on
+// a blamed node are left alone, and the node is cordoned or tainted unless MaxNodes
+// nodes already are.
+type NodePolicy struct {
+	Action       string `json:"action"`
+	MinWorkloads int32  `json:"minWorkloads"`
+	MaxNodes     int32  `json:"maxNodes"`
+}
+
+// ImagePolicy configures blocking image digests. The digests of the containers of
+// a workload the controller acts on are blocked, and other workloads running them
+// are warned about, or acted on as if they were crash-looping. Blocks expire after
+// TTL, zero meaning never.
+type ImagePolicy struct {
+	Action    string          `json:"action"`
+	TTL       metav1.Duration `json:"ttl"`
+	Admission ImageAdmission  `json:"admission"`
+}
+
+// ImageAdmission configures the admission webhook checking new workloads against
+// the blocked images. Action applies in every namespace not listed in Namespaces,
+// which sets it per namespace.
+type ImageAdmission struct {
+	Action     string            `json:"action"`
+	Namespaces map[string]string `json:"namespaces"`
+}
+
+// ActionFor returns the admission action in effect in the namespace.
+func (a ImageAdmission) ActionFor(namespace string) string {
+	if action, exists := a.Namespaces[namespace]; exists {
+		return action
+	}
+	return a.Action
+}
+
+// RoutePolicy configures the cname-phase of Routes. A route still initializing
+// after InitializingTimeout fails, and failed routes are retried after
+// RetryInitial, doubling on every failure up to RetryMax.
+type RoutePolicy struct {
+	InitializingTimeout metav1.Duration `json:"initializingTimeout"`
+	RetryInitial        metav1.Duration `json:"retryInitial"`
+	RetryMax            metav1.Duration `json:"retryMax"`
+}
+
+// Notifiers configures where notifications are delivered. Notifications are
+// always logged.
+type Notifiers struct {
+	WebhookURL string `json:"webhookURL"`
+}
+
+// Guardrails bound what the controller may do regardless of policy.
+type Guardrails struct {
+	// ExcludedNamespaces are never acted in, even if watched
+	ExcludedNamespaces []string `json:"excludedNamespaces"`
+	// MaxActiveQuarantines stops new remediations once this many Quarantines are
+	// open across the cluster; zero means no limit
+	MaxActiveQuarantines int `json:"maxActiveQuarantines"`
+}
+
+// Webhook configures the admission webhook served by 'deploymentpodctl webhook'.
+type Webhook struct {
+	// Address is the address the webhook listens on
+	Address string `json:"address"`
+	// CertDir is where the webhook's kubernetes.io/tls Secret is mounted
+	CertDir string `json:"certDir"`
+}
+
+// AddressManagement configures the address management (AM) API holding the CNAME
+// aliases of route hosts. When URL is empty routes are only checked against the
+// routers that admitted them, and never moved. The credentials are always taken
+// from AM_USERNAME and AM_PASSWORD.
+type AddressManagement struct {
+	URL     string          `json:"url"`
+	Timeout metav1.Duration `json:"timeout"`
+}
+
+// GSLB configures the global server load balancer, which fails routes over between
+// datacenters. The entry of every route host is kept pointing at the route's RP in
+// the local Datacenter. Nothing is done when URL is empty. The GSLB entries are
+// listed at most once per CacheTTL, and the credentials are always taken from
+// GSLB_USERNAME and GSLB_PASSWORD.
+type GSLB struct {
+	URL        string          `json:"url"`
+	Timeout    metav1.Duration `json:"timeout"`
+	CacheTTL   metav1.Duration `json:"cacheTTL"`
+	Datacenter string          `json:"datacenter"`
+}
+
+// LoadBalancer configures the NetScaler API of the load balancers in front of the
+// RPs. The global reconcile keeps the IP and serviceName of the service and monitor
+// of every route host pointed at its RP. Nothing is done when URL is empty, and the
+// credentials are always taken from LB_USERNAME and LB_PASSWORD.
+type LoadBalancer struct {
+	URL     string          `json:"url"`
+	Timeout metav1.Duration `json:"timeout"`
+}
+
+// Metrics configures the Prometheus metrics endpoint of the controller.
+type Metrics struct {
+	// Address is the address metrics are served on, empty to disable them
+	Address string `json:"address"`
+}
+
+// Default returns the configuration used for any field the file does not set.
+func Default() *Config {
+	return &Config{
+		APIVersion:         APIVersion,
+		Kind:               Kind,
+		ResyncPeriod:       metav1.Duration{Duration: 24 * time.Hour},
+		GlobalResyncPeriod: metav1.Duration{Duration: 24 * time.Hour},
+		Workers:            8,
+		MaxRetries:         10,
+		Policy: Policy{
+			WatchedNamespaces: []string{"test-bh-alln-7nov"},
+			RestartThreshold:  1,
+			Quorum: QuorumPolicy{
+				MinReplicas: 1,
+			},
+			Action: ActionScale,
+			Scale: ScalePolicy{
+				Strategy: ScaleZero,
+				Step:     1,
+				Floor:    0,
+				Interval: metav1.Duration{Duration: 5 * time.Minute},
+			},
+			Approval: ApprovalPolicy{
+				Timeout:         metav1.Duration{Duration: time.Hour},
+				TimeoutDecision: Rejected,
+			},
+			DebugTwin: DebugTwinPolicy{
+				Mode:       DebugTwinDisabled,
+				Command:    []string{"sleep", "3600"},
+				TTL:        metav1.Duration{Duration: time.Hour},
+				GCInterval: metav1.Duration{Duration: 5 * time.Minute},
+			},
+			Node: NodePolicy{
+				Action:       NodeActionDisabled,
+				MinWorkloads: 3,
+				MaxNodes:     1,
+			},
+			Images: ImagePolicy{
+				Action: ImageActionWarn,
+				TTL:    metav1.Duration{Duration: 7 * 24 * time.Hour},
+				Admission: ImageAdmission{
+					Action: AdmissionWarn,
+				},
+			},
+		},
+		Routes: RoutePolicy{
+			InitializingTimeout: metav1.Duration{Duration: 30 * time.Minute},
+			RetryInitial:        metav1.Duration{Duration: time.Minute},
+			RetryMax:            metav1.Duration{Duration: time.Hour},
+		},
+		Webhook: Webhook{
+			Address: ":8443",
+			CertDir: "/etc/webhook/certs",
+		},
+		AddressManagement: AddressManagement{
+			Timeout: metav1.Duration{Duration: 10 * time.Second},
+		},
+		GSLB: GSLB{
+			Timeout:  metav1.Duration{Duration: 10 * time.Second},
+			CacheTTL: metav1.Duration{Duration: 5 * time.Minute},
+		},
+		LoadBalancer: LoadBalancer{
+			Timeout: metav1.Duration{Duration: 10 * time.Second},
+		},
+		Metrics: Metrics{
+			Address: ":8080",
+		},
+	}
+}
+
+// Parse reads a configuration file on top of the defaults. Unknown fields are
+// rejected so that typos do not silently fall back to a default.
+func Parse(data []byte) (*Config, error) {
+	config := Default()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return config, nil
+	}
+
+	raw, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides fields from the environment variables the controller has
+// always honoured, so existing deployment manifests keep working. It returns an
+// error for every variable that is set but cannot be parsed.
+func (c *Config) ApplyEnv() []string {
+	var errs []string
+	duration := func(key string, field *metav1.Duration) {
+		if v := os.Getenv(key); len(v) > 0 {
+			dur, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("env %s: invalid duration %q", key, v))
+				return
+			}
+			field.Duration = dur
+		}
+	}
+	integer := func(key string, field *int) {
+		if v := os.Getenv(key); len(v) > 0 {
+			vint, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("env %s: invalid integer %q", key, v))
+				return
+			}
+			*field = vint
+		}
+	}
+	integer32 := func(key string, field *int32) {
+		v := int(*field)
+		integer(key, &v)
+		*field = int32(v)
+	}
+	str := func(key string, field *string) {
+		if v := os.Getenv(key); len(v) > 0 {
+			*field = v
+		}
+	}
+	list := func(key string, field *[]string) {
+		if v := strings.Fields(os.Getenv(key)); len(v) > 0 {
+			*field = v
+		}
+	}
+
+	duration("RESYNC_PERIOD", &c.ResyncPeriod)
+	duration("GLOBAL_RESYNC_PERIOD", &c.GlobalResyncPeriod)
+	integer("WORKER_THREADS", &c.Workers)
+	integer("MAX_RETRIES", &c.MaxRetries)
+	list("WATCHED_NAMESPACES", &c.Policy.WatchedNamespaces)
+	integer32("RESTART_THRESHOLD", &c.Policy.RestartThreshold)
+	integer32("QUORUM_MIN_REPLICAS", &c.Policy.Quorum.MinReplicas)
+	integer32("QUORUM_PERCENT", &c.Policy.Quorum.Percent)
+	str("REMEDIATION_ACTION", &c.Policy.Action)
+	str("SCALE_STRATEGY", &c.Policy.Scale.Strategy)
+	integer32("SCALE_STEP", &c.Policy.Scale.Step)
+	integer32("SCALE_FLOOR", &c.Policy.Scale.Floor)
+	duration("SCALE_STEP_INTERVAL", &c.Policy.Scale.Interval)
+	list("APPROVAL_NAMESPACES", &c.Policy.Approval.Namespaces)
+	duration("APPROVAL_TIMEOUT", &c.Policy.Approval.Timeout)
+	str("APPROVAL_TIMEOUT_DECISION", &c.Policy.Approval.TimeoutDecision)
+	str("DEBUG_TWIN_MODE", &c.Policy.DebugTwin.Mode)
+	list("DEBUG_TWIN_COMMAND", &c.Policy.DebugTwin.Command)
+	duration("DEBUG_TWIN_TTL", &c.Policy.DebugTwin.TTL)
+	duration("DEBUG_TWIN_GC_INTERVAL", &c.Policy.DebugTwin.GCInterval)
+	str("NODE_ACTION", &c.Policy.Node.Action)
+	integer32("NODE_MIN_WORKLOADS", &c.Policy.Node.MinWorkloads)
+	integer32("NODE_MAX_NODES", &c.Policy.Node.MaxNodes)
+	str("IMAGE_ACTION", &c.Policy.Images.Action)
+	duration("IMAGE_TTL", &c.Policy.Images.TTL)
+	str("IMAGE_ADMISSION_ACTION", &c.Policy.Images.Admission.Action)
+	duration("ROUTE_INITIALIZING_TIMEOUT", &c.Routes.InitializingTimeout)
+	duration("ROUTE_RETRY_INITIAL", &c.Routes.RetryInitial)
+	duration("ROUTE_RETRY_MAX", &c.Routes.RetryMax)
+	str("NOTIFY_WEBHOOK_URL", &c.Notifiers.WebhookURL)
+	str("WEBHOOK_ADDRESS", &c.Webhook.Address)
+	str("WEBHOOK_CERT_DIR", &c.Webhook.CertDir)
+	str("AM_URL", &c.AddressManagement.URL)
+	duration("AM_TIMEOUT", &c.AddressManagement.Timeout)
+	str("GSLB_URL", &c.GSLB.URL)
+	duration("GSLB_TIMEOUT", &c.GSLB.Timeout)
+	duration("GSLB_CACHE_TTL", &c.GSLB.CacheTTL)
+	str("LOCAL_DC", &c.GSLB.Datacenter)
+	str("LB_URL", &c.LoadBalancer.URL)
+	duration("LB_TIMEOUT", &c.LoadBalancer.Timeout)
+	str("METRICS_ADDRESS", &c.Metrics.Address)
+	return errs
+}
+
+// ValidationError lists every invalid field of a configuration.
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(e.Errors, "\n  "))
+}
+
+// oneOf reports whether value is one of the allowed values.
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks every field and returns a ValidationError listing all of the
+// invalid ones, or nil if the configuration is usable.
+func (c *Config) Validate() error {
+	var errs []string
+	invalid := func(field, format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, a...)))
+	}
+	positive := func(field string, d metav1.Duration) {
+		if d.Duration <= 0 {
+			invalid(field, "must be a positive duration, got %v", d.Duration)
+		}
+	}
+
+	if c.APIVersion != APIVersion {
+		invalid("apiVersion", "must be %s, got %q", APIVersion, c.APIVersion)
+	}
+	if c.Kind != Kind {
+		invalid("kind", "must be %s, got %q", Kind, c.Kind)
+	}
+	positive("resyncPeriod", c.ResyncPeriod)
+	positive("globalResyncPeriod", c.GlobalResyncPeriod)
+	if c.Workers < 1 {
+		invalid("workers", "must be at least 1, got %d", c.Workers)
+	}
+	if c.MaxRetries < 0 {
+		invalid("maxRetries", "must not be negative, got %d", c.MaxRetries)
+	}
+
+	policy := c.Policy
+	if policy.RestartThreshold < 0 {
+		invalid("policy.restartThreshold", "must not be negative, got %d", policy.RestartThreshold)
+	}
+	if policy.Quorum.MinReplicas < 0 {
+		invalid("policy.quorum.minReplicas", "must not be negative, got %d", policy.Quorum.MinReplicas)
+	}
+	if policy.Quorum.Percent < 0 || policy.Quorum.Percent > 100 {
+		invalid("policy.quorum.percent", "must be between 0 and 100, got %d", policy.Quorum.Percent)
+	}
+	if policy.Quorum.MinReplicas == 0 && policy.Quorum.Percent == 0 {
+		invalid("policy.quorum", "one of minReplicas or percent must be set")
+	}
+	if !oneOf(policy.Action, ActionScale, ActionPause, ActionBoth) {
+		invalid("policy.action", "must be one of %s, %s or %s, got %q", ActionScale, ActionPause, ActionBoth, policy.Action)
+	}
+	if !oneOf(policy.Scale.Strategy, ScaleZero, ScaleHalve, ScaleStep) {
+		invalid("policy.scale.strategy", "must be one of %s, %s or %s, got %q", ScaleZero, ScaleHalve, ScaleStep, policy.Scale.Strategy)
+	}
+	if policy.Scale.Step < 1 {
+		invalid("policy.scale.step", "must be at least 1, got %d", policy.Scale.Step)
+	}
+	if policy.Scale.Floor < 0 {
+		invalid("policy.scale.floor", "must not be negative, got %d", policy.Scale.Floor)
+	}
+	positive("policy.scale.interval", policy.Scale.Interval)
+	positive("policy.approval.timeout", policy.Approval.Timeout)
+	if !oneOf(policy.Approval.TimeoutDecision, Approved, Rejected) {
+		invalid("policy.approval.timeoutDecision", "must be %s or %s, got %q", Approved, Rejected, policy.Approval.TimeoutDecision)
+	}
+	if !oneOf(policy.DebugTwin.Mode, DebugTwinDisabled, DebugTwinBefore, DebugTwinInstead) {
+		invalid("policy.debugTwin.mode", "must be one of %s, %s or %s, got %q", DebugTwinDisabled, DebugTwinBefore, DebugTwinInstead, policy.DebugTwin.Mode)
+	}
+	if len(policy.DebugTwin.Command) == 0 {
+		invalid("policy.debugTwin.command", "must not be empty")
+	}
+	positive("policy.debugTwin.ttl", policy.DebugTwin.TTL)
+	positive("policy.debugTwin.gcInterval", policy.DebugTwin.GCInterval)
+	if !oneOf(policy.Node.Action, NodeActionDisabled, NodeActionCordon, NodeActionTaint) {
+		invalid("policy.node.action", "must be one of %s, %s or %s, got %q", NodeActionDisabled, NodeActionCordon, NodeActionTaint, policy.Node.Action)
+	}
+	if policy.Node.MinWorkloads < 2 {
+		invalid("policy.node.minWorkloads", "must be at least 2, got %d", policy.Node.MinWorkloads)
+	}
+	if policy.Node.MaxNodes < 0 {
+		invalid("policy.node.maxNodes", "must not be negative, got %d", policy.Node.MaxNodes)
+	}
+	if !oneOf(policy.Images.Action, ImageActionDisabled, ImageActionWarn, ImageActionAct) {
+		invalid("policy.images.action", "must be one of %s, %s or %s, got %q", ImageActionDisabled, ImageActionWarn, ImageActionAct, policy.Images.Action)
+	}
+	if policy.Images.TTL.Duration < 0 {
+		invalid("policy.images.ttl", "must not be negative, got %v", policy.Images.TTL.Duration)
+	}
+	if !oneOf(policy.Images.Admission.Action, AdmissionDisabled, AdmissionWarn, AdmissionDeny) {
+		invalid("policy.images.admission.action", "must be one of %s, %s or %s, got %q", AdmissionDisabled, AdmissionWarn, AdmissionDeny, policy.Images.Admission.Action)
+	}
+	for namespace, action := range policy.Images.Admission.Namespaces {
+		if !oneOf(action, AdmissionDisabled, AdmissionWarn, AdmissionDeny) {
+			invalid("policy.images.admission.namespaces."+namespace, "must be one of %s, %s or %s, got %q", AdmissionDisabled, AdmissionWarn, AdmissionDeny, action)
+		}
+	}
+
+	positive("routes.initializingTimeout", c.Routes.InitializingTimeout)
+	positive("routes.retryInitial", c.Routes.RetryInitial)
+	positive("routes.retryMax", c.Routes.RetryMax)
+	if c.Routes.RetryMax.Duration < c.Routes.RetryInitial.Duration {
+		invalid("routes.retryMax", "must not be less than retryInitial, got %v", c.Routes.RetryMax.Duration)
+	}
+
+	if len(c.Notifiers.WebhookURL) > 0 {
+		if u, err := url.Parse(c.Notifiers.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			invalid("notifiers.webhookURL", "must be an http or https URL, got %q", c.Notifiers.WebhookURL)
+		}
+	}
+	if c.Guardrails.MaxActiveQuarantines < 0 {
+		invalid("guardrails.maxActiveQuarantines", "must not be negative, got %d", c.Guardrails.MaxActiveQuarantines)
+	}
+	if len(c.Webhook.Address) == 0 {
+		invalid("webhook.address", "must not be empty")
+	}
+	if len(c.Webhook.CertDir) == 0 {
+		invalid("webhook.certDir", "must not be empty")
+	}
+	if len(c.AddressManagement.URL) > 0 {
+		if u, err := url.Parse(c.AddressManagement.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			invalid("addressManagement.url", "must be an http or https URL, got %q", c.AddressManagement.URL)
+		}
+	}
+	positive("addressManagement.timeout", c.AddressManagement.Timeout)
+	if len(c.GSLB.URL) > 0 {
+		if u, err := url.Parse(c.GSLB.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			invalid("gslb.url", "must be an http or https URL, got %q", c.GSLB.URL)
+		}
+		if len(c.GSLB.Datacenter) == 0 {
+			invalid("gslb.datacenter", "must be set when gslb.url is")
+		}
+	}
+	positive("gslb.timeout", c.GSLB.Timeout)
+	positive("gslb.cacheTTL", c.GSLB.CacheTTL)
+	if len(c.LoadBalancer.URL) > 0 {
+		if u, err := url.Parse(c.LoadBalancer.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			invalid("loadBalancer.url", "must be an http or https URL, got %q", c.LoadBalancer.URL)
+		}
+	}
+	positive("loadBalancer.timeout", c.LoadBalancer.Timeout)
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Contains reports whether the namespace is in the list.
+func Contains(namespaces []string, namespace string) bool {
+	for _, n := range namespaces {
+		if n == namespace {
+			return true
+		}
+	}
+	return false
+}
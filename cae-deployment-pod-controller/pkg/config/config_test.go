@@ -0,0 +1,400 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    func(*Config)
+		wantErr string
+	}{
+		{
+			name: "an empty file is the defaults",
+			data: "  \n",
+		},
+		{
+			name: "set fields override the defaults, the others are kept",
+			data: "apiVersion: xxx.xxx.com/v1alpha1\nkind: DeploymentPodControllerConfig\nworkers: 2\npolicy:\n  action: both\n  scale:\n    interval: 1m\n",
+			want: func(c *Config) {
+				c.Workers = 2
+				c.Policy.Action = ActionBoth
+				c.Policy.Scale.Interval = metav1.Duration{Duration: time.Minute}
+			},
+		},
+		{
+			name:    "unknown fields are rejected",
+			data:    "policy:\n  restartTreshold: 3\n",
+			wantErr: "restartTreshold",
+		},
+		{
+			name:    "invalid YAML",
+			data:    "policy: [action",
+			wantErr: "invalid YAML",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Parse([]byte(test.data))
+			if len(test.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Parse() error = %v, want one mentioning %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			want := Default()
+			if test.want != nil {
+				test.want(want)
+			}
+			if !reflect.DeepEqual(config, want) {
+				t.Errorf("Parse() = %+v, want %+v", config, want)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("Validate() of the parsed configuration = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		mutate     func(*Config)
+		wantFields []string
+	}{
+		{
+			name:   "defaults",
+			mutate: func(c *Config) {},
+		},
+		{
+			name:       "apiVersion",
+			mutate:     func(c *Config) { c.APIVersion = "v1" },
+			wantFields: []string{"apiVersion"},
+		},
+		{
+			name:       "kind",
+			mutate:     func(c *Config) { c.Kind = "Config" },
+			wantFields: []string{"kind"},
+		},
+		{
+			name:       "resyncPeriod",
+			mutate:     func(c *Config) { c.ResyncPeriod.Duration = 0 },
+			wantFields: []string{"resyncPeriod"},
+		},
+		{
+			name:       "globalResyncPeriod",
+			mutate:     func(c *Config) { c.GlobalResyncPeriod.Duration = -time.Minute },
+			wantFields: []string{"globalResyncPeriod"},
+		},
+		{
+			name:       "workers",
+			mutate:     func(c *Config) { c.Workers = 0 },
+			wantFields: []string{"workers"},
+		},
+		{
+			name:       "maxRetries",
+			mutate:     func(c *Config) { c.MaxRetries = -1 },
+			wantFields: []string{"maxRetries"},
+		},
+		{
+			name:       "policy.restartThreshold",
+			mutate:     func(c *Config) { c.Policy.RestartThreshold = -1 },
+			wantFields: []string{"policy.restartThreshold"},
+		},
+		{
+			name:       "policy.quorum.minReplicas",
+			mutate:     func(c *Config) { c.Policy.Quorum.MinReplicas = -1 },
+			wantFields: []string{"policy.quorum.minReplicas"},
+		},
+		{
+			name:       "policy.quorum.percent",
+			mutate:     func(c *Config) { c.Policy.Quorum.Percent = 101 },
+			wantFields: []string{"policy.quorum.percent"},
+		},
+		{
+			name:       "policy.quorum without either half",
+			mutate:     func(c *Config) { c.Policy.Quorum = QuorumPolicy{} },
+			wantFields: []string{"policy.quorum"},
+		},
+		{
+			name:       "policy.action",
+			mutate:     func(c *Config) { c.Policy.Action = "delete" },
+			wantFields: []string{"policy.action"},
+		},
+		{
+			name:       "policy.scale.strategy",
+			mutate:     func(c *Config) { c.Policy.Scale.Strategy = "third" },
+			wantFields: []string{"policy.scale.strategy"},
+		},
+		{
+			name:       "policy.scale.step",
+			mutate:     func(c *Config) { c.Policy.Scale.Step = 0 },
+			wantFields: []string{"policy.scale.step"},
+		},
+		{
+			name:       "policy.scale.floor",
+			mutate:     func(c *Config) { c.Policy.Scale.Floor = -1 },
+			wantFields: []string{"policy.scale.floor"},
+		},
+		{
+			name:       "policy.scale.interval",
+			mutate:     func(c *Config) { c.Policy.Scale.Interval.Duration = 0 },
+			wantFields: []string{"policy.scale.interval"},
+		},
+		{
+			name:       "policy.approval.timeout",
+			mutate:     func(c *Config) { c.Policy.Approval.Timeout.Duration = 0 },
+			wantFields: []string{"policy.approval.timeout"},
+		},
+		{
+			name:       "policy.approval.timeoutDecision",
+			mutate:     func(c *Config) { c.Policy.Approval.TimeoutDecision = "ignored" },
+			wantFields: []string{"policy.approval.timeoutDecision"},
+		},
+		{
+			name:       "policy.debugTwin.mode",
+			mutate:     func(c *Config) { c.Policy.DebugTwin.Mode = "after" },
+			wantFields: []string{"policy.debugTwin.mode"},
+		},
+		{
+			name:       "policy.debugTwin.command",
+			mutate:     func(c *Config) { c.Policy.DebugTwin.Command = nil },
+			wantFields: []string{"policy.debugTwin.command"},
+		},
+		{
+			name:       "policy.debugTwin.ttl",
+			mutate:     func(c *Config) { c.Policy.DebugTwin.TTL.Duration = 0 },
+			wantFields: []string{"policy.debugTwin.ttl"},
+		},
+		{
+			name:       "policy.debugTwin.gcInterval",
+			mutate:     func(c *Config) { c.Policy.DebugTwin.GCInterval.Duration = 0 },
+			wantFields: []string{"policy.debugTwin.gcInterval"},
+		},
+		{
+			name:       "policy.node.action",
+			mutate:     func(c *Config) { c.Policy.Node.Action = "drain" },
+			wantFields: []string{"policy.node.action"},
+		},
+		{
+			name:       "policy.node.minWorkloads",
+			mutate:     func(c *Config) { c.Policy.Node.MinWorkloads = 1 },
+			wantFields: []string{"policy.node.minWorkloads"},
+		},
+		{
+			name:       "policy.node.maxNodes",
+			mutate:     func(c *Config) { c.Policy.Node.MaxNodes = -1 },
+			wantFields: []string{"policy.node.maxNodes"},
+		},
+		{
+			name:       "policy.images.action",
+			mutate:     func(c *Config) { c.Policy.Images.Action = "deny" },
+			wantFields: []string{"policy.images.action"},
+		},
+		{
+			name:       "policy.images.ttl",
+			mutate:     func(c *Config) { c.Policy.Images.TTL.Duration = -time.Hour },
+			wantFields: []string{"policy.images.ttl"},
+		},
+		{
+			name:       "policy.images.admission.action",
+			mutate:     func(c *Config) { c.Policy.Images.Admission.Action = "act" },
+			wantFields: []string{"policy.images.admission.action"},
+		},
+		{
+			name: "policy.images.admission.namespaces",
+			mutate: func(c *Config) {
+				c.Policy.Images.Admission.Namespaces = map[string]string{"team-a": AdmissionDeny, "team-b": "block"}
+			},
+			wantFields: []string{"policy.images.admission.namespaces.team-b"},
+		},
+		{
+			name:       "routes.initializingTimeout",
+			mutate:     func(c *Config) { c.Routes.InitializingTimeout.Duration = 0 },
+			wantFields: []string{"routes.initializingTimeout"},
+		},
+		{
+			name:       "routes.retryInitial",
+			mutate:     func(c *Config) { c.Routes.RetryInitial.Duration = 0 },
+			wantFields: []string{"routes.retryInitial"},
+		},
+		{
+			name:       "routes.retryMax less than retryInitial",
+			mutate:     func(c *Config) { c.Routes.RetryMax.Duration = 30 * time.Second },
+			wantFields: []string{"routes.retryMax"},
+		},
+		{
+			name:       "routes.retryMax",
+			mutate:     func(c *Config) { c.Routes.RetryMax.Duration = 0 },
+			wantFields: []string{"routes.retryMax", "routes.retryMax"},
+		},
+		{
+			name:       "notifiers.webhookURL",
+			mutate:     func(c *Config) { c.Notifiers.WebhookURL = "hooks.example.com/notify" },
+			wantFields: []string{"notifiers.webhookURL"},
+		},
+		{
+			name:       "guardrails.maxActiveQuarantines",
+			mutate:     func(c *Config) { c.Guardrails.MaxActiveQuarantines = -1 },
+			wantFields: []string{"guardrails.maxActiveQuarantines"},
+		},
+		{
+			name:       "webhook.address",
+			mutate:     func(c *Config) { c.Webhook.Address = "" },
+			wantFields: []string{"webhook.address"},
+		},
+		{
+			name:       "webhook.certDir",
+			mutate:     func(c *Config) { c.Webhook.CertDir = "" },
+			wantFields: []string{"webhook.certDir"},
+		},
+		{
+			name:       "addressManagement.url",
+			mutate:     func(c *Config) { c.AddressManagement.URL = "ftp://am.example.com" },
+			wantFields: []string{"addressManagement.url"},
+		},
+		{
+			name:       "addressManagement.timeout",
+			mutate:     func(c *Config) { c.AddressManagement.Timeout.Duration = 0 },
+			wantFields: []string{"addressManagement.timeout"},
+		},
+		{
+			name: "gslb.url",
+			mutate: func(c *Config) {
+				c.GSLB.URL = "gslb.example.com"
+				c.GSLB.Datacenter = "alln"
+			},
+			wantFields: []string{"gslb.url"},
+		},
+		{
+			name:       "gslb.datacenter",
+			mutate:     func(c *Config) { c.GSLB.URL = "https://gslb.example.com" },
+			wantFields: []string{"gslb.datacenter"},
+		},
+		{
+			name:       "gslb.timeout",
+			mutate:     func(c *Config) { c.GSLB.Timeout.Duration = 0 },
+			wantFields: []string{"gslb.timeout"},
+		},
+		{
+			name:       "gslb.cacheTTL",
+			mutate:     func(c *Config) { c.GSLB.CacheTTL.Duration = 0 },
+			wantFields: []string{"gslb.cacheTTL"},
+		},
+		{
+			name:       "loadBalancer.url",
+			mutate:     func(c *Config) { c.LoadBalancer.URL = "ftp://lb.example.com" },
+			wantFields: []string{"loadBalancer.url"},
+		},
+		{
+			name:       "loadBalancer.timeout",
+			mutate:     func(c *Config) { c.LoadBalancer.Timeout.Duration = 0 },
+			wantFields: []string{"loadBalancer.timeout"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Default()
+			test.mutate(config)
+			err := config.Validate()
+			if len(test.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			validationErr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			if len(validationErr.Errors) != len(test.wantFields) {
+				t.Fatalf("Validate() errors = %q, want one for each of %q", validationErr.Errors, test.wantFields)
+			}
+			for i, field := range test.wantFields {
+				if !strings.HasPrefix(validationErr.Errors[i], field+": ") {
+					t.Errorf("Validate() error %q, want one for %s", validationErr.Errors[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		want     func(*Config)
+		wantErrs int
+	}{
+		{
+			name: "nothing set",
+		},
+		{
+			name: "every kind of field",
+			env: map[string]string{
+				"RESYNC_PERIOD":      "1h",
+				"WORKER_THREADS":     "4",
+				"WATCHED_NAMESPACES": " team-a  team-b ",
+				"QUORUM_PERCENT":     "50",
+				"REMEDIATION_ACTION": ActionPause,
+				"LOCAL_DC":           "rcdn",
+			},
+			want: func(c *Config) {
+				c.ResyncPeriod = metav1.Duration{Duration: time.Hour}
+				c.Workers = 4
+				c.Policy.WatchedNamespaces = []string{"team-a", "team-b"}
+				c.Policy.Quorum.Percent = 50
+				c.Policy.Action = ActionPause
+				c.GSLB.Datacenter = "rcdn"
+			},
+		},
+		{
+			name: "unparseable values are reported and leave the field alone",
+			env: map[string]string{
+				"GLOBAL_RESYNC_PERIOD": "daily",
+				"MAX_RETRIES":          "ten",
+				"SCALE_STEP":           "2.5",
+				"SCALE_FLOOR":          "1",
+			},
+			want: func(c *Config) {
+				c.Policy.Scale.Floor = 1
+			},
+			wantErrs: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			config := Default()
+			errs := config.ApplyEnv()
+			if len(errs) != test.wantErrs {
+				t.Errorf("ApplyEnv() errors = %q, want %d", errs, test.wantErrs)
+			}
+			want := Default()
+			if test.want != nil {
+				test.want(want)
+			}
+			if !reflect.DeepEqual(config, want) {
+				t.Errorf("ApplyEnv() = %+v, want %+v", config, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	dv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// crashReason describes why the controller acted on the pod's workload.
+func crashReason(pod *v1.Pod, threshold int32) string {
+	return fmt.Sprintf("pod %s exceeded %d restarts", pod.Name, threshold)
+}
+
+// actionFor returns the name of the remediation applied to workloads of the kind,
+// given the configured remediation action for DeploymentConfigs and Deployments.
+func actionFor(kind, action string) string {
+	switch kind {
+	case kindDaemonSet:
+		return actionHaltRollout
+	case kindJob:
+		return actionStopJob
+	}
+	return action
+}
+
+// resolveWorkload determines the kind and name of the workload the crashing pod
+// belongs to. DaemonSets and Jobs are found through the pod's owner, DeploymentConfigs
+// and Deployments through the informer caches using the pod's workload key. An empty
+// kind means the workload is unknown to the controller.
+func (c *Controller) resolveWorkload(pod *v1.Pod, key string) (string, string, error) {
+	if owner := metav1.GetControllerOf(pod); owner != nil && (owner.Kind == kindDaemonSet || owner.Kind == kindJob) {
+		return owner.Kind, owner.Name, nil
+	}
+
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	_, dcExists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("Error fetching DeploymentConfig with key %s from cache: %v", key, err)
+	}
+	if dcExists {
+		return kindDeploymentConfig, name, nil
+	}
+	_, dExists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("Error fetching Deployment with key %s from cache: %v", key, err)
+	}
+	if dExists {
+		return kindDeployment, name, nil
+	}
+	return "", "", nil
+}
+
+// executeAction applies the kind-appropriate remediation to the workload.
+func (c *Controller) executeAction(kind, namespace, name, reason string) error {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	switch kind {
+	case kindDeploymentConfig:
+		obj, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return fmt.Errorf("Error fetching DeploymentConfig with key %s from cache: %v", key, err)
+		}
+		if !exists {
+			return errortypes.Errorf("DeploymentConfig %s no longer exists", key)
+		}
+		return c.remediateDeploymentConfig(obj.(*dcv1.DeploymentConfig))
+	case kindDeployment:
+		obj, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return fmt.Errorf("Error fetching Deployment with key %s from cache: %v", key, err)
+		}
+		if !exists {
+			return errortypes.Errorf("Deployment %s no longer exists", key)
+		}
+		return c.remediateDeployment(obj.(*dv1.Deployment))
+	case kindDaemonSet:
+		return c.haltDaemonSet(namespace, name)
+	case kindJob:
+		return c.stopJob(namespace, name, reason)
+	}
+	return errortypes.Errorf("Unsupported workload kind %s for %s", kind, key)
+}
+
+// quarantineWorkload carries out the decision for the crashing pod's workload. While
+// a Quarantine is Active, further crashes keep applying the action so progressive
+// step-downs continue. Otherwise the action is applied and recorded in a new Active
+// Quarantine, or, in namespaces that require approval, only proposed as a Pending one.
+func (c *Controller) quarantineWorkload(decision *Decision, pod *v1.Pod) error {
+	kind, name := decision.Kind, decision.Name
+	reason := crashReason(pod, c.currentConfig().Policy.RestartThreshold)
+	if decision.ImageBlocked {
+		reason = fmt.Sprintf("pod %s runs blocked image %s", pod.Name, decision.BlockedImage)
+	}
+
+	if decision.Quarantine != nil {
+		return c.executeAction(kind, pod.Namespace, name, reason)
+	}
+	if err := c.clearReleasedQuarantine(kind, pod.Namespace, name); err != nil {
+		return err
+	}
+
+	if decision.Approval {
+		quarantine, err := c.createQuarantine(kind, pod.Namespace, name, reason, quarantinev1alpha1.PhasePending)
+		if err != nil || quarantine == nil {
+			return err
+		}
+		c.notify(quarantine, fmt.Sprintf("Proposed %s on %s %s/%s, waiting for approval: %s", quarantine.Spec.Action, kind, pod.Namespace, name, reason))
+		return nil
+	}
+
+	if err := c.executeAction(kind, pod.Namespace, name, reason); err != nil {
+		return err
+	}
+	quarantine, err := c.createQuarantine(kind, pod.Namespace, name, reason, quarantinev1alpha1.PhaseActive)
+	if err != nil || quarantine == nil {
+		return err
+	}
+	c.notify(quarantine, fmt.Sprintf("Applied %s on %s %s/%s: %s", quarantine.Spec.Action, kind, pod.Namespace, name, reason))
+	return nil
+}
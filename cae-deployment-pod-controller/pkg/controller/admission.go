@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	dv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// The admission webhook looks workloads, Quarantines and blocked images up through
+// these, from the informer caches.
+
+// ActiveQuarantine returns the Active Quarantine of the workload, or nil if it has
+// none. Pending Quarantines are not returned, since nothing was done to the workload
+// yet.
+func (c *Controller) ActiveQuarantine(kind, namespace, name string) (*quarantinev1alpha1.Quarantine, error) {
+	quarantine, err := c.openQuarantine(kind, namespace, name)
+	if err != nil || quarantine == nil || quarantine.Status.Phase != quarantinev1alpha1.PhaseActive {
+		return nil, err
+	}
+	return quarantine, nil
+}
+
+// WorkloadAnnotations returns the annotations of the DeploymentConfig or Deployment,
+// or nil if it is not in the cache.
+func (c *Controller) WorkloadAnnotations(kind, namespace, name string) (map[string]string, error) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	switch kind {
+	case kindDeploymentConfig:
+		obj, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			return nil, err
+		}
+		return obj.(*dcv1.DeploymentConfig).GetAnnotations(), nil
+	case kindDeployment:
+		obj, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			return nil, err
+		}
+		return obj.(*dv1.Deployment).GetAnnotations(), nil
+	}
+	return nil, fmt.Errorf("Unsupported workload kind %s for %s", kind, key)
+}
+
+// PodWorkloadName returns the name of the workload the pod belongs to, or an empty
+// string if it is unknown.
+func (c *Controller) PodWorkloadName(pod *v1.Pod) string {
+	return workloadNameForPod(pod)
+}
+
+// ImageAdmission returns what the webhook does with workloads referencing a blocked
+// image in the namespace.
+func (c *Controller) ImageAdmission(namespace string) string {
+	return c.currentConfig().Policy.Images.Admission.ActionFor(namespace)
+}
+
+// normalizeImage expands an image reference the way the container runtime reports
+// it, so 'nginx:1.19' matches 'docker.io/library/nginx:1.19'.
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+	if !strings.Contains(image, "@") && !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+// ImageBlock explains why the image reference is blocked for the workload, or
+// returns an empty string if it is not. Only a reference by the blocked digest is
+// blocked outright. A reference by the tag the digest was running under when it was
+// blocked is reported as not exact, since the tag may have moved to a fixed build
+// since, and the reference is only to be warned about.
+func (c *Controller) ImageBlock(namespace, workload, image string) (string, bool, error) {
+	images, err := c.blockedImagesFromCache()
+	if err != nil {
+		return "", false, err
+	}
+
+	var digest string
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		digest = image[i+1:]
+	}
+	now := c.now()
+	var tagged *BlockedImage
+	for _, blocked := range images {
+		if blocked.Expired(now) || !blocked.blocks(fmt.Sprintf("%s/%s", namespace, workload)) {
+			continue
+		}
+		if len(digest) > 0 && blocked.Digest == digest {
+			return blocked.Describe(), true, nil
+		}
+		if tagged == nil && len(digest) == 0 && len(blocked.Image) > 0 && normalizeImage(blocked.Image) == normalizeImage(image) {
+			tagged = blocked
+		}
+	}
+	if tagged != nil {
+		return fmt.Sprintf("%s ran as %s, unless the tag has moved since: %s", tagged.Digest, image, tagged.Describe()), false, nil
+	}
+	return "", false, nil
+}
+
+// blockedImagesFromCache returns the blocked images from the ConfigMap informer,
+// since the webhook does not run the reload worker that keeps them in memory.
+func (c *Controller) blockedImagesFromCache() (map[string]*BlockedImage, error) {
+	if c.ConfigMapInformer == nil {
+		return c.currentBlockedImages(), nil
+	}
+	key := fmt.Sprintf("%s/%s", c.Namespace, blockedImagesConfigMap)
+	obj, exists, err := c.ConfigMapInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching ConfigMap %s from cache: %v", key, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	images, errs := parseBlockedImages(obj.(*v1.ConfigMap).Data)
+	for _, err := range errs {
+		klog.Warningf("Skipping invalid blocked image %s", err)
+	}
+	return images, nil
+}
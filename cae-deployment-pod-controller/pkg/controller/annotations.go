@@ -1,67 +1,240 @@
-package controller
-
-import (
-	"fmt"
-
-	v1 "github.com/openshift/api/route/v1"
-)
-
-const (
-	cnamePhase   = "xxx.xxx.com/cname-phase"
-	initializing = "initializing"
-	failed       = "failed"
-	complete     = "complete"
-)
-
-// getAnnotations returns the cname-phase annotation. If it does not exist,
-// set the annotation to a default value of 'initializing', which indicates
-// that the Route is waiting for ACC to assign an initial alias.
-func getRouteAnnotations(route *v1.Route) (map[string]string, string) {
-	annotations := route.GetAnnotations()
-	if len(annotations) == 0 {
-		annotations = map[string]string{}
-	}
-
-	if _, exist := annotations[cnamePhase]; !exist {
-		annotations[cnamePhase] = initializing
-	}
-	return annotations, annotations[cnamePhase]
-}
-
-// updateRouteAnnotation will update the cname-phase annotation if it changes
-func (c *Controller) updateRouteAnnotation(route *v1.Route, a map[string]string, phase string) {
-	if a[cnamePhase] == phase {
-		return
-	}
-
-	if len(phase) > 0 {
-		copy := route.DeepCopy()
-		a[cnamePhase] = phase
-		copy.SetAnnotations(a)
-		//c.RouteClient.RouteV1().Routes(copy.Namespace).Update(copy)
-	}
-}
-
-// A route is considered to be in the 'initializing' phase if it has the initializing
-// phase annotation, and address management does not return any current aliases for the
-// cname. If no annotation is found at the beginning of UpdateRoute, add a temporary
-// annotation of 'initializing'.
-func isRouteInitializing(phase, actual string) bool {
-	return phase == initializing && len(actual) == 0
-}
-
-// initializingError returns an error indicating that the route is waiting for ACC,
-// and sets the route's annotation to 'failed'
-func (c *Controller) initializingError(cname string, route *v1.Route, a map[string]string) error {
-	c.updateRouteAnnotation(route, a, initializing)
-	return fmt.Errorf("Waiting for initial cname assignment - cname: %s, route: %s/%s", cname, route.Namespace, route.Name)
-}
-
-func (c *Controller) annotateFailed(err error, route *v1.Route, a map[string]string) error {
-	c.updateRouteAnnotation(route, a, failed)
-	return err
-}
-
-func (c *Controller) annotateComplete(route *v1.Route, a map[string]string) {
-	c.updateRouteAnnotation(route, a, complete)
-}
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "github.com/openshift/api/route/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	cnamePhase           = "xxx.xxx.com/cname-phase"
+	cnamePhaseReason     = "xxx.xxx.com/cname-phase-reason"
+	cnamePhaseSince      = "xxx.xxx.com/cname-phase-since"
+	cnamePhaseRetries    = "xxx.xxx.com/cname-phase-retries"
+	cnamePhaseNextRetry  = "xxx.xxx.com/cname-phase-next-retry"
+	cnamePhaseGeneration = "xxx.xxx.com/cname-phase-generation"
+
+	initializing = "initializing"
+	failed       = "failed"
+	complete     = "complete"
+
+	reasonCnameInitializing = "CnameInitializing"
+	reasonCnameComplete     = "CnameComplete"
+	reasonCnameFailed       = "CnameFailed"
+)
+
+// routeTransitions are the cname-phases a route may move to from each phase. A route
+// only waits in 'initializing' until its cname is first given an alias, so no phase
+// goes back to it.
+var routeTransitions = map[string][]string{
+	initializing: {initializing, complete, failed},
+	failed:       {failed, complete},
+	complete:     {complete, failed},
+}
+
+// routeEvents are the Event types and reasons emitted on entering each phase.
+var routeEvents = map[string][2]string{
+	initializing: {corev1.EventTypeNormal, reasonCnameInitializing},
+	complete:     {corev1.EventTypeNormal, reasonCnameComplete},
+	failed:       {corev1.EventTypeWarning, reasonCnameFailed},
+}
+
+// routeState is the cname-phase state machine of a Route, kept in its annotations:
+// the phase, why the route is in it and since when, and for failed routes how many
+// times they were retried, when the next retry is due and the generation of the
+// route they failed with.
+type routeState struct {
+	Phase      string
+	Reason     string
+	Since      time.Time
+	Retries    int
+	NextRetry  time.Time
+	Generation int64
+}
+
+// getRouteState reads the route's cname-phase state. A route without the annotation
+// is 'initializing' since it was created, which indicates that the Route is waiting
+// for ACC to assign an initial alias. Unparseable timestamps and counts read as zero,
+// and a failed route without a generation failed with its current one.
+func getRouteState(route *v1.Route) routeState {
+	annotations := route.GetAnnotations()
+	state := routeState{
+		Phase:  annotations[cnamePhase],
+		Reason: annotations[cnamePhaseReason],
+	}
+	if _, valid := routeTransitions[state.Phase]; !valid {
+		state = routeState{Phase: initializing, Since: route.CreationTimestamp.Time}
+	}
+	if since, err := time.Parse(time.RFC3339, annotations[cnamePhaseSince]); err == nil {
+		state.Since = since
+	}
+	state.Retries, _ = strconv.Atoi(annotations[cnamePhaseRetries])
+	state.NextRetry, _ = time.Parse(time.RFC3339, annotations[cnamePhaseNextRetry])
+	generation, err := strconv.ParseInt(annotations[cnamePhaseGeneration], 10, 64)
+	if err != nil {
+		generation = route.Generation
+	}
+	state.Generation = generation
+	return state
+}
+
+// setAnnotations writes the state into a copy of the annotations.
+func (s routeState) setAnnotations(annotations map[string]string) map[string]string {
+	copy := map[string]string{}
+	for key, value := range annotations {
+		copy[key] = value
+	}
+	copy[cnamePhase] = s.Phase
+	copy[cnamePhaseReason] = s.Reason
+	copy[cnamePhaseSince] = s.Since.UTC().Format(time.RFC3339)
+	delete(copy, cnamePhaseRetries)
+	delete(copy, cnamePhaseNextRetry)
+	delete(copy, cnamePhaseGeneration)
+	if s.Phase == failed {
+		copy[cnamePhaseRetries] = strconv.Itoa(s.Retries)
+		copy[cnamePhaseNextRetry] = s.NextRetry.UTC().Format(time.RFC3339)
+		copy[cnamePhaseGeneration] = strconv.FormatInt(s.Generation, 10)
+	}
+	return copy
+}
+
+// retryBackoff returns how long to wait before retrying a route that failed after
+// the given number of retries, doubling from the initial backoff up to the maximum.
+func retryBackoff(retries int, routes config.RoutePolicy) time.Duration {
+	backoff := routes.RetryInitial.Duration
+	for i := 0; i < retries && backoff < routes.RetryMax.Duration; i++ {
+		backoff *= 2
+	}
+	if backoff > routes.RetryMax.Duration {
+		backoff = routes.RetryMax.Duration
+	}
+	return backoff
+}
+
+// transition returns the state after moving the route at the generation to the phase
+// at now. Entering a phase resets its timestamp and retries; failing again counts a
+// retry and backs off the next one further, unless the route changed since, which
+// starts the retries over.
+func (s routeState) transition(phase, reason string, generation int64, now time.Time, routes config.RoutePolicy) (routeState, error) {
+	allowed := false
+	for _, next := range routeTransitions[s.Phase] {
+		allowed = allowed || next == phase
+	}
+	if !allowed {
+		return s, fmt.Errorf("invalid cname-phase transition from %s to %s", s.Phase, phase)
+	}
+
+	next := routeState{Phase: phase, Reason: reason, Since: s.Since}
+	if phase != s.Phase || s.Since.IsZero() {
+		next.Since = now
+	}
+	if phase == failed {
+		next.Generation = generation
+		if s.Phase == failed && s.Generation == generation {
+			next.Retries = s.Retries + 1
+		}
+		next.NextRetry = now.Add(retryBackoff(next.Retries, routes))
+	}
+	return next, nil
+}
+
+// requeueRoute processes the route again after the delay.
+func (c *Controller) requeueRoute(route *v1.Route, after time.Duration) {
+	if c.RouteQueue != nil {
+		c.RouteQueue.AddAfter(fmt.Sprintf("%s/%s", route.Namespace, route.Name), after)
+	}
+}
+
+// setRoutePhase moves the route to the phase, updating its annotations if the state
+// changed and emitting an Event when the phase did.
+func (c *Controller) setRoutePhase(route *v1.Route, state routeState, phase, reason string) (routeState, error) {
+	next, err := state.transition(phase, reason, route.Generation, c.now(), c.currentConfig().Routes)
+	if err != nil {
+		return state, errortypes.Errorf("Error updating route %s/%s: %v", route.Namespace, route.Name, err)
+	}
+	annotations := route.GetAnnotations()
+	if next == state && annotations[cnamePhase] == phase {
+		return state, nil
+	}
+
+	copy := route.DeepCopy()
+	copy.SetAnnotations(next.setAnnotations(annotations))
+	if _, err := c.RouteClient.RouteV1().Routes(copy.Namespace).Update(copy); err != nil {
+		return state, fmt.Errorf("Error updating %s annotation of route %s/%s to %s: %v", cnamePhase, copy.Namespace, copy.Name, phase, err)
+	}
+
+	if phase != state.Phase || annotations[cnamePhase] != phase {
+		klog.Infof("Route %s/%s is now %s: %s", copy.Namespace, copy.Name, phase, reason)
+		event := routeEvents[phase]
+		c.event(route, event[0], event[1], reason)
+	} else if phase == failed {
+		klog.Infof("Route %s/%s failed again, retry %d at %s: %s", copy.Namespace, copy.Name, next.Retries, next.NextRetry.Format(time.RFC3339), reason)
+	}
+	return next, nil
+}
+
+// A route is considered to be in the 'initializing' phase if it has the initializing
+// phase annotation, and address management does not return any current aliases for the
+// cname. A route without the annotation is initializing.
+func isRouteInitializing(phase, actual string) bool {
+	return phase == initializing && len(actual) == 0
+}
+
+// waitForRetry reports whether the route failed and its next retry is not due yet,
+// requeueing it for then. Updates of the route's metadata in the meantime, including
+// the ones made by the controller, do not retry it early, but a change of its spec,
+// which bumps its generation, is retried at once.
+func (c *Controller) waitForRetry(route *v1.Route, state routeState) bool {
+	if state.Phase != failed || state.Generation != route.Generation {
+		return false
+	}
+	if wait := state.NextRetry.Sub(c.now()); wait > 0 {
+		c.requeueRoute(route, wait)
+		return true
+	}
+	return false
+}
+
+// initializingError returns an error indicating that the route is waiting for ACC,
+// and keeps the route 'initializing'. A route still initializing after the
+// initializing timeout is failed instead.
+func (c *Controller) initializingError(cname string, route *v1.Route, state routeState) error {
+	timeout := c.currentConfig().Routes.InitializingTimeout.Duration
+	remaining := timeout - c.now().Sub(state.Since)
+	if remaining <= 0 {
+		return c.annotateFailed(errortypes.Errorf("Timed out after %v waiting for initial cname assignment - cname: %s, route: %s/%s",
+			timeout, cname, route.Namespace, route.Name), route, state)
+	}
+
+	if _, err := c.setRoutePhase(route, state, initializing, "Waiting for address management to assign an initial alias"); err != nil {
+		return err
+	}
+	// the rate limited retries may give up before the timeout
+	c.requeueRoute(route, remaining)
+	return fmt.Errorf("Waiting for initial cname assignment - cname: %s, route: %s/%s", cname, route.Namespace, route.Name)
+}
+
+// annotateFailed sets the route to 'failed' with err as the reason and schedules the
+// next retry with backoff. The retries are driven by the cname-phase, so err is
+// returned as non-retryable, unless the route could not be updated.
+func (c *Controller) annotateFailed(err error, route *v1.Route, state routeState) error {
+	next, updateErr := c.setRoutePhase(route, state, failed, err.Error())
+	if updateErr != nil {
+		klog.Errorf("%v", err)
+		return updateErr
+	}
+	c.requeueRoute(route, next.NextRetry.Sub(c.now()))
+	return errortypes.New(err.Error())
+}
+
+// annotateComplete sets the route to 'complete' on the RP.
+func (c *Controller) annotateComplete(route *v1.Route, state routeState, rp string) error {
+	_, err := c.setRoutePhase(route, state, complete, fmt.Sprintf("Route is on the expected RP %s", rp))
+	return err
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	approvalAnnotation   = quarantinev1alpha1.ApprovalAnnotation
+	approvedByAnnotation = quarantinev1alpha1.ApprovedByAnnotation
+
+	approved = config.Approved
+	rejected = config.Rejected
+)
+
+// requiresApproval determines if remediations in the namespace need a human decision,
+// which is the case for the critical namespaces listed in the approval policy.
+func requiresApproval(policy config.ApprovalPolicy, namespace string) bool {
+	return config.Contains(policy.Namespaces, namespace)
+}
+
+// approvalDecision returns the decision recorded on the Quarantine and who made it.
+// The approver is the user the admission webhook recorded in the approved-by
+// annotation when the approval annotation was set. Without it, as when the webhook
+// is not installed or was unavailable, the approver is unknown.
+func approvalDecision(quarantine *quarantinev1alpha1.Quarantine) (string, string) {
+	annotations := quarantine.GetAnnotations()
+	decision := strings.ToLower(annotations[approvalAnnotation])
+	if decision != approved && decision != rejected {
+		return "", ""
+	}
+
+	if approver := annotations[approvedByAnnotation]; len(approver) > 0 {
+		return decision, approver
+	}
+	return decision, "unknown"
+}
+
+// reconcilePending executes or rejects a proposed remediation once a decision is
+// recorded on the Quarantine, or once the approval timeout elapses, in which case the
+// configured default decision applies. Until then the key is requeued for when the
+// timeout is due.
+func (c *Controller) reconcilePending(key string, quarantine *quarantinev1alpha1.Quarantine) error {
+	policy := c.currentConfig().Policy.Approval
+	decision, approver := approvalDecision(quarantine)
+	if len(decision) == 0 {
+		elapsed := c.now().Sub(quarantine.CreationTimestamp.Time)
+		if elapsed < policy.Timeout.Duration {
+			c.QuarantineQueue.AddAfter(key, policy.Timeout.Duration-elapsed)
+			return nil
+		}
+		decision, approver = policy.TimeoutDecision, fmt.Sprintf("timeout after %v", policy.Timeout.Duration)
+	}
+
+	now := metav1.Now()
+	workload := quarantine.Spec.Workload
+	quarantine.Status.ApprovedBy = approver
+	quarantine.Status.DecidedAt = &now
+
+	if decision != approved {
+		quarantine.Status.Phase = quarantinev1alpha1.PhaseRejected
+		quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+			Type:               quarantinev1alpha1.ConditionApproved,
+			Status:             v1.ConditionFalse,
+			Reason:             "Rejected",
+			Message:            fmt.Sprintf("rejected by %s", approver),
+			LastTransitionTime: now,
+		})
+		klog.Infof("Quarantine %s rejected by %s", key, approver)
+		if err := c.updateQuarantineStatus(quarantine); err != nil {
+			return err
+		}
+		c.notify(quarantine, fmt.Sprintf("Rejected %s on %s %s/%s by %s", quarantine.Spec.Action, workload.Kind, quarantine.Namespace, workload.Name, approver))
+		return nil
+	}
+
+	if err := c.executeAction(workload.Kind, quarantine.Namespace, workload.Name, quarantine.Spec.Reason); err != nil {
+		return err
+	}
+
+	// record what the action saved on the workload, as for unapproved remediations
+	originalState, err := c.originalState(workload.Kind, quarantine.Namespace, workload.Name)
+	if err != nil {
+		return err
+	}
+	quarantine.Spec.OriginalState = originalState
+	status := quarantine.Status
+	quarantine, err = c.updateQuarantine(quarantine)
+	if err != nil {
+		return err
+	}
+	quarantine.Status = status
+
+	quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+		Type:               quarantinev1alpha1.ConditionApproved,
+		Status:             v1.ConditionTrue,
+		Reason:             "Approved",
+		Message:            fmt.Sprintf("approved by %s", approver),
+		LastTransitionTime: now,
+	})
+	markActive(quarantine)
+	klog.Infof("Quarantine %s approved by %s", key, approver)
+	if err := c.updateQuarantineStatus(quarantine); err != nil {
+		return err
+	}
+	c.notify(quarantine, fmt.Sprintf("Applied %s on %s %s/%s, approved by %s", quarantine.Spec.Action, workload.Kind, quarantine.Namespace, workload.Name, approver))
+	return nil
+}
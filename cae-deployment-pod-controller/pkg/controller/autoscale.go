@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	gocache "github.com/patrickmn/go-cache"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	kedaCacheKey = "KEDA_AVAILABLE_CACHE_KEY"
+
+	originalHPAAnnotation        = "xxx.xxx.com/original-hpa"
+	kedaPausedAnnotation         = "xxx.xxx.com/keda-paused"
+	kedaPausedReplicasAnnotation = "autoscaling.keda.sh/paused-replicas"
+)
+
+var (
+	scaledObjectResource = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "scaledobjects"}
+)
+
+// hpaLimits is the part of an HPA spec the controller overrides, saved as JSON
+// in the original-hpa annotation so it can be put back on restore.
+type hpaLimits struct {
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas int32  `json:"maxReplicas"`
+}
+
+// isOwnedByScaledObject reports whether the HPA was created by KEDA, in which case
+// it is handled through its ScaledObject instead.
+func isOwnedByScaledObject(hpa *autoscalingv1.HorizontalPodAutoscaler) bool {
+	for _, owner := range hpa.GetOwnerReferences() {
+		if owner.Kind == "ScaledObject" {
+			return true
+		}
+	}
+	return false
+}
+
+// hpasForWorkload lists the HPAs in the namespace whose scale target is the workload.
+// They are read from the HPA informer, or listed from the API by the operator
+// commands, which do not run it.
+func (c *Controller) hpasForWorkload(kind, namespace, name string) ([]*autoscalingv1.HorizontalPodAutoscaler, error) {
+	var all []*autoscalingv1.HorizontalPodAutoscaler
+	if c.HPAInformer != nil {
+		objs, err := c.HPAInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing HorizontalPodAutoscalers in namespace %s from cache: %v", namespace, err)
+		}
+		for _, obj := range objs {
+			if hpa, ok := obj.(*autoscalingv1.HorizontalPodAutoscaler); ok {
+				all = append(all, hpa)
+			}
+		}
+	} else {
+		list, err := c.KubeClient.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Error listing HorizontalPodAutoscalers in namespace %s: %v", namespace, err)
+		}
+		for i := range list.Items {
+			all = append(all, &list.Items[i])
+		}
+	}
+
+	var hpas []*autoscalingv1.HorizontalPodAutoscaler
+	for _, hpa := range all {
+		if hpa.Spec.ScaleTargetRef.Kind == kind && hpa.Spec.ScaleTargetRef.Name == name && !isOwnedByScaledObject(hpa) {
+			hpas = append(hpas, hpa)
+		}
+	}
+	return hpas, nil
+}
+
+// isKedaAvailable determines if the ScaledObject CRD is served by the cluster. The
+// answer is cached so discovery is not hit on every step-down.
+func (c *Controller) isKedaAvailable() bool {
+	if available, found := c.Gocache.Get(kedaCacheKey); found {
+		return available.(bool)
+	}
+
+	available := false
+	resources, err := c.KubeClient.Discovery().ServerResourcesForGroupVersion(scaledObjectResource.GroupVersion().String())
+	if err == nil {
+		for _, resource := range resources.APIResources {
+			if resource.Name == scaledObjectResource.Resource {
+				available = true
+			}
+		}
+	}
+	c.Gocache.Set(kedaCacheKey, available, gocache.DefaultExpiration)
+	return available
+}
+
+// scaledObjectsForWorkload lists the KEDA ScaledObjects in the namespace whose scale
+// target is the workload. KEDA defaults the target kind to Deployment.
+func (c *Controller) scaledObjectsForWorkload(kind, namespace, name string) ([]unstructured.Unstructured, error) {
+	if !c.isKedaAvailable() {
+		return nil, nil
+	}
+
+	list, err := c.DynamicClient.Resource(scaledObjectResource).Namespace(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing ScaledObjects in namespace %s: %v", namespace, err)
+	}
+
+	var scaledObjects []unstructured.Unstructured
+	for _, scaledObject := range list.Items {
+		targetName, _, _ := unstructured.NestedString(scaledObject.Object, "spec", "scaleTargetRef", "name")
+		targetKind, _, _ := unstructured.NestedString(scaledObject.Object, "spec", "scaleTargetRef", "kind")
+		if len(targetKind) == 0 {
+			targetKind = kindDeployment
+		}
+		if targetKind == kind && targetName == name {
+			scaledObjects = append(scaledObjects, scaledObject)
+		}
+	}
+	return scaledObjects, nil
+}
+
+// holdAutoscalers stops HPAs and ScaledObjects targeting the workload from undoing a
+// step-down. HPAs are pinned to the stepped-down replica count (HPAs cannot go below
+// one replica), and ScaledObjects are paused with KEDA's paused-replicas annotation.
+// The original HPA limits are saved only once so restore sees the user's settings.
+// It is called before the workload is scaled, so an autoscaler never sees the
+// lower replica count while it is still free to scale back up.
+func (c *Controller) holdAutoscalers(kind, namespace, name string, replicas int32) error {
+	hpas, err := c.hpasForWorkload(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	pinned := replicas
+	if pinned < 1 {
+		pinned = 1
+	}
+	for _, hpa := range hpas {
+		copy := hpa.DeepCopy()
+		annotations := copy.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if _, exists := annotations[originalHPAAnnotation]; !exists {
+			original, err := json.Marshal(hpaLimits{MinReplicas: copy.Spec.MinReplicas, MaxReplicas: copy.Spec.MaxReplicas})
+			if err != nil {
+				return fmt.Errorf("Error saving limits of HorizontalPodAutoscaler %s/%s: %v", copy.Namespace, copy.Name, err)
+			}
+			annotations[originalHPAAnnotation] = string(original)
+		}
+		copy.SetAnnotations(annotations)
+		copy.Spec.MinReplicas = &pinned
+		copy.Spec.MaxReplicas = pinned
+
+		klog.Infof("Pinning HorizontalPodAutoscaler %s/%s to %d replicas", copy.Namespace, copy.Name, pinned)
+		if _, err := c.KubeClient.AutoscalingV1().HorizontalPodAutoscalers(copy.Namespace).Update(copy); err != nil {
+			return fmt.Errorf("Error updating HorizontalPodAutoscaler %s/%s: %v", copy.Namespace, copy.Name, err)
+		}
+	}
+
+	scaledObjects, err := c.scaledObjectsForWorkload(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	for _, scaledObject := range scaledObjects {
+		copy := scaledObject.DeepCopy()
+		annotations := copy.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if _, userPaused := annotations[kedaPausedReplicasAnnotation]; userPaused && annotations[kedaPausedAnnotation] != "true" {
+			continue
+		}
+		annotations[kedaPausedAnnotation] = "true"
+		annotations[kedaPausedReplicasAnnotation] = strconv.Itoa(int(replicas))
+		copy.SetAnnotations(annotations)
+
+		klog.Infof("Pausing ScaledObject %s/%s at %d replicas", copy.GetNamespace(), copy.GetName(), replicas)
+		if _, err := c.DynamicClient.Resource(scaledObjectResource).Namespace(copy.GetNamespace()).Update(copy, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("Error pausing ScaledObject %s/%s: %v", copy.GetNamespace(), copy.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// releaseAutoscalers puts back the HPA limits and unpauses the ScaledObjects that
+// holdAutoscalers changed for the workload.
+func (c *Controller) releaseAutoscalers(kind, namespace, name string) error {
+	hpas, err := c.hpasForWorkload(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	for _, hpa := range hpas {
+		original, exists := hpa.GetAnnotations()[originalHPAAnnotation]
+		if !exists {
+			continue
+		}
+		limits := hpaLimits{}
+		if err := json.Unmarshal([]byte(original), &limits); err != nil {
+			return fmt.Errorf("Error parsing %s annotation of HorizontalPodAutoscaler %s/%s: %v", originalHPAAnnotation, hpa.Namespace, hpa.Name, err)
+		}
+
+		copy := hpa.DeepCopy()
+		copy.Spec.MinReplicas = limits.MinReplicas
+		copy.Spec.MaxReplicas = limits.MaxReplicas
+		delete(copy.Annotations, originalHPAAnnotation)
+
+		klog.Infof("Restoring HorizontalPodAutoscaler %s/%s", copy.Namespace, copy.Name)
+		if _, err := c.KubeClient.AutoscalingV1().HorizontalPodAutoscalers(copy.Namespace).Update(copy); err != nil {
+			return fmt.Errorf("Error restoring HorizontalPodAutoscaler %s/%s: %v", copy.Namespace, copy.Name, err)
+		}
+	}
+
+	scaledObjects, err := c.scaledObjectsForWorkload(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	for _, scaledObject := range scaledObjects {
+		annotations := scaledObject.GetAnnotations()
+		if annotations[kedaPausedAnnotation] != "true" {
+			continue
+		}
+
+		copy := scaledObject.DeepCopy()
+		annotations = copy.GetAnnotations()
+		delete(annotations, kedaPausedAnnotation)
+		delete(annotations, kedaPausedReplicasAnnotation)
+		copy.SetAnnotations(annotations)
+
+		klog.Infof("Unpausing ScaledObject %s/%s", copy.GetNamespace(), copy.GetName())
+		if _, err := c.DynamicClient.Resource(scaledObjectResource).Namespace(copy.GetNamespace()).Update(copy, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("Error unpausing ScaledObject %s/%s: %v", copy.GetNamespace(), copy.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	v1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// BlacklistRule is an entry of the blacklist. Each line of blacklist.properties is
+// '<pattern> [namespace=<namespace>] [expires=<RFC3339 time>]', where the pattern is
+// an exact hostname, a hostname with '*' wildcards each matching a single DNS label,
+// such as '*.example.com', or a regular expression prefixed with '~' matching the
+// whole hostname. Hostnames are matched regardless of case. A rule with a namespace
+// only applies to routes in it, and a rule with an expiry stops applying at that time.
+type BlacklistRule struct {
+	// Entry is the line the rule was parsed from
+	Entry     string
+	Pattern   string
+	Namespace string
+	Expires   time.Time
+
+	// regexp matches wildcard and regular expression patterns, nil for exact ones
+	regexp *regexp.Regexp
+}
+
+// Blacklist is the list of rules, in the order they were listed.
+type Blacklist []*BlacklistRule
+
+// parseBlacklistRule parses a single line of blacklist.properties.
+func parseBlacklistRule(entry string) (*BlacklistRule, error) {
+	fields := strings.Fields(entry)
+	rule := &BlacklistRule{Entry: entry, Pattern: fields[0]}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		switch {
+		case len(kv) == 2 && kv[0] == "namespace" && len(kv[1]) > 0:
+			rule.Namespace = kv[1]
+		case len(kv) == 2 && kv[0] == "expires":
+			expires, err := time.Parse(time.RFC3339, kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("%q has an invalid expiry, expected an RFC3339 time: %v", entry, err)
+			}
+			rule.Expires = expires
+		default:
+			return nil, fmt.Errorf("%q has an unknown option %q, expected namespace=<namespace> or expires=<time>", entry, field)
+		}
+	}
+
+	var expr string
+	switch {
+	case strings.HasPrefix(rule.Pattern, "~"):
+		// matched without case, lower-casing the expression would change escapes such as \S
+		expr = "(?i)^(?:" + strings.TrimPrefix(rule.Pattern, "~") + ")$"
+	case strings.Contains(rule.Pattern, "*"):
+		rule.Pattern = strings.ToLower(rule.Pattern)
+		expr = "^" + strings.Replace(regexp.QuoteMeta(rule.Pattern), `\*`, `[^.]+`, -1) + "$"
+	default:
+		rule.Pattern = strings.ToLower(rule.Pattern)
+		return rule, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid regular expression: %v", entry, err)
+	}
+	rule.regexp = re
+	return rule, nil
+}
+
+// Expired reports whether the rule no longer applies at now.
+func (r *BlacklistRule) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// Matches reports whether the rule applies to the host of a route in the namespace
+// at now.
+func (r *BlacklistRule) Matches(host, namespace string, now time.Time) bool {
+	if r.Expired(now) || (len(r.Namespace) > 0 && r.Namespace != namespace) {
+		return false
+	}
+	host = strings.ToLower(host)
+	if r.regexp != nil {
+		return r.regexp.MatchString(host)
+	}
+	return r.Pattern == host
+}
+
+// Match returns the first rule applying to the host of a route in the namespace at
+// now, or nil if the host is not blacklisted.
+func (b Blacklist) Match(host, namespace string, now time.Time) *BlacklistRule {
+	for _, rule := range b {
+		if rule.Matches(host, namespace, now) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Entries returns the lines the rules were parsed from.
+func (b Blacklist) Entries() []string {
+	entries := make([]string, 0, len(b))
+	for _, rule := range b {
+		entries = append(entries, rule.Entry)
+	}
+	return entries
+}
+
+func initializeBlackList() Blacklist {
+	parsed, errs := parseBlackList(os.Getenv("BLACKLIST_HOSTS"))
+	for _, err := range errs {
+		klog.Errorf("Skipping invalid BLACKLIST_HOSTS entry: %s", err)
+	}
+	return parsed
+}
+
+// parseBlackList parses newline-separated rules, as found in the
+// blacklist.properties key of the blacklist ConfigMap. Entries that are not blank
+// and cannot be parsed are returned as errors, the rest are kept.
+func parseBlackList(data string) (Blacklist, []string) {
+	var errs []string
+	blacklist := Blacklist{}
+	for _, entry := range strings.Split(data, "\n") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		rule, err := parseBlacklistRule(entry)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		blacklist = append(blacklist, rule)
+	}
+	return blacklist, errs
+}
+
+// isBlackListed determines if a route is marked as blacklisted. These values are stored
+// in a configMap to support a more dynamic ability to changes these hostnames.
+func (c *Controller) isBlackListed(cname string, route *v1.Route) bool {
+	if rule := c.currentBlacklist().Match(cname, route.Namespace, c.now()); rule != nil {
+		klog.Infof("Found a blacklisted host - cname: %s, route: %s/%s, rule: %s", cname, route.Namespace, route.Name, rule.Entry)
+		return true
+	}
+	return false
+}
+
+// BlacklistRuleFor returns the rule blacklisting the host of a route in the
+// namespace, or nil if it is not blacklisted. The rules are read from the ConfigMap
+// informer, since the operator commands do not run the reload worker.
+func (c *Controller) BlacklistRuleFor(host, namespace string) (*BlacklistRule, error) {
+	rules := c.currentBlacklist()
+	if c.ConfigMapInformer != nil {
+		key := fmt.Sprintf("%s/%s", c.Namespace, blacklistConfigMap)
+		obj, exists, err := c.ConfigMapInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching ConfigMap %s from cache: %v", key, err)
+		}
+		if exists {
+			var errs []string
+			rules, errs = parseBlackList(obj.(*corev1.ConfigMap).Data[blacklistKey])
+			for _, err := range errs {
+				klog.Warningf("Skipping invalid blacklist entry %s", err)
+			}
+		}
+	}
+	return rules.Match(host, namespace, c.now()), nil
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBlackList(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantEntries []string
+		wantErrs    int
+	}{
+		{
+			name:        "blank lines and comments are skipped",
+			data:        "\n# *.example.com\n  app.example.com  \n\n",
+			wantEntries: []string{"app.example.com"},
+		},
+		{
+			name:        "unknown option",
+			data:        "app.example.com owner=team\nother.example.com",
+			wantEntries: []string{"other.example.com"},
+			wantErrs:    1,
+		},
+		{
+			name:     "empty namespace",
+			data:     "app.example.com namespace=",
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid expiry",
+			data:     "app.example.com expires=2030-01-01",
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid regular expression",
+			data:     "~api-[0-9+\\.example\\.com",
+			wantErrs: 1,
+		},
+		{
+			name:        "every option",
+			data:        "*.example.com namespace=team expires=2030-01-01T00:00:00Z",
+			wantEntries: []string{"*.example.com namespace=team expires=2030-01-01T00:00:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blacklist, errs := parseBlackList(test.data)
+			if len(errs) != test.wantErrs {
+				t.Errorf("parseBlackList() errors = %v, want %d", errs, test.wantErrs)
+			}
+			entries := blacklist.Entries()
+			if len(entries) != len(test.wantEntries) {
+				t.Fatalf("parseBlackList() entries = %q, want %q", entries, test.wantEntries)
+			}
+			for i := range entries {
+				if entries[i] != test.wantEntries[i] {
+					t.Errorf("parseBlackList() entries = %q, want %q", entries, test.wantEntries)
+				}
+			}
+		})
+	}
+}
+
+func TestBlacklistMatch(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		rule      string
+		host      string
+		namespace string
+		want      bool
+	}{
+		{name: "exact host", rule: "app.example.com", host: "app.example.com", want: true},
+		{name: "exact host does not match a subdomain", rule: "app.example.com", host: "x.app.example.com"},
+		{name: "exact host ignores case", rule: "App.Example.com", host: "APP.example.COM", want: true},
+
+		{name: "wildcard matches one label", rule: "*.example.com", host: "app.example.com", want: true},
+		{name: "wildcard does not match two labels", rule: "*.example.com", host: "a.b.example.com"},
+		{name: "wildcard does not match the bare domain", rule: "*.example.com", host: "example.com"},
+		{name: "wildcard in the middle", rule: "app.*.example.com", host: "app.eu.example.com", want: true},
+		{name: "wildcard dots are literal", rule: "*.example.com", host: "app.examplexcom"},
+		{name: "wildcard ignores case", rule: "*.EXAMPLE.com", host: "App.example.Com", want: true},
+
+		{name: "regular expression", rule: `~api-[0-9]+\.example\.com`, host: "api-12.example.com", want: true},
+		{name: "regular expression is anchored at the start", rule: `~api-[0-9]+\.example\.com`, host: "xapi-12.example.com"},
+		{name: "regular expression is anchored at the end", rule: `~api-[0-9]+\.example\.com`, host: "api-12.example.com.evil.com"},
+		{name: "regular expression alternatives are anchored", rule: `~a\.example\.com|b\.example\.com`, host: "xb.example.com"},
+		{name: "regular expression ignores case", rule: `~API-[0-9]+\.example\.com`, host: "api-1.Example.com", want: true},
+		{name: "regular expression escapes keep their meaning", rule: `~\S+\.example\.com`, host: "app.example.com", want: true},
+
+		{name: "namespace rule in its namespace", rule: "app.example.com namespace=team", host: "app.example.com", namespace: "team", want: true},
+		{name: "namespace rule in another namespace", rule: "app.example.com namespace=team", host: "app.example.com", namespace: "other"},
+		{name: "rule without namespace in any namespace", rule: "app.example.com", host: "app.example.com", namespace: "other", want: true},
+
+		{name: "rule before its expiry", rule: "app.example.com expires=2020-01-01T12:00:01Z", host: "app.example.com", want: true},
+		{name: "rule at its expiry", rule: "app.example.com expires=2020-01-01T12:00:00Z", host: "app.example.com"},
+		{name: "rule after its expiry", rule: "app.example.com expires=2019-12-31T00:00:00Z", host: "app.example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blacklist, errs := parseBlackList(test.rule)
+			if len(errs) > 0 || len(blacklist) != 1 {
+				t.Fatalf("parseBlackList(%q) = %v, %v, want one rule", test.rule, blacklist, errs)
+			}
+			if rule := blacklist.Match(test.host, test.namespace, now); (rule != nil) != test.want {
+				t.Errorf("Match(%q, %q) = %v, want a match %t", test.host, test.namespace, rule, test.want)
+			}
+		})
+	}
+}
@@ -1,147 +1,341 @@
-package controller
-
-import (
-	"fmt"
-	"sync"
-	"time"
-
-	deploymentconfigv1client "github.com/openshift/client-go/apps/clientset/versioned"
-	gocache "github.com/patrickmn/go-cache"
-	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-
-	//podv1client "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/kubernetes"
-	v1 "k8s.io/client-go/listers/core/v1"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog"
-)
-
-var (
-	maxRetries = 10
-)
-
-type Controller struct {
-	DeploymentConfigClient   *deploymentconfigv1client.Clientset
-	KubeClient               *kubernetes.Clientset
-	DeploymentConfigInformer cache.SharedIndexInformer
-	DeploymentInformer       cache.SharedIndexInformer
-	PodInformer              cache.SharedIndexInformer
-	DeploymentConfigQueue    workqueue.RateLimitingInterface
-	DeploymentQueue          workqueue.RateLimitingInterface
-	PodQueue                 workqueue.RateLimitingInterface
-	NamespaceLister          v1.NamespaceLister
-	Gocache                  *gocache.Cache
-	//PodClient        *podv1client.CoreV1Client
-}
-
-// Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
-func (c *Controller) Run(threads int, stopCh <-chan struct{}) error {
-
-	var (
-		waitGroup sync.WaitGroup
-	)
-
-	defer utilruntime.HandleCrash()
-	defer c.PodQueue.ShutDown()
-
-	klog.Infof("Starting Pod Controller")
-	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
-		return fmt.Errorf("failed to wait for caches to sync")
-	}
-	klog.Infof("Cache sync complete")
-
-	// run 'threads' number of workers to process Route resources
-	for i := 0; i < threads; i++ {
-		createWorker(c.PodQueue, c.processPod, stopCh, &waitGroup)
-		//createWorker(c.GlobalQueue, c.processGlobalRoute, stopCh, &waitGroup)
-	}
-
-	klog.Infof("Started Pod workers")
-	<-stopCh
-	klog.Infof("Shutting down workers")
-	waitGroup.Wait()
-	return nil
-}
-
-// HasSynced allows us to satisfy the Controller interface
-// by wiring up the informer's HasSynced method to it
-func (c *Controller) HasSynced() bool {
-	return c.PodInformer.HasSynced()
-}
-
-// createWorker creates and runs a worker thread that just processes items in the
-// specified queue. The worker will run until stopCh is closed. The worker will be
-// added to the wait group when started and marked done when finished.
-func createWorker(queue workqueue.RateLimitingInterface, reconciler func(key string) error, stopCh <-chan struct{}, waitGroup *sync.WaitGroup) {
-	waitGroup.Add(1)
-	go func() {
-		wait.Until(runWorker(queue, reconciler), time.Second, stopCh)
-		waitGroup.Done()
-	}()
-}
-
-// runWorker retrieves each queued item and takes the necessary
-// handler action based off if the item was created, updated, or deleted
-func runWorker(queue workqueue.RateLimitingInterface, processItem func(key string) error) func() {
-	return func() {
-		running := true
-		for running {
-			running = func() bool {
-				key, quit := queue.Get()
-
-				// stop the worker loop if shutdown message was placed in queue
-				if quit {
-					return false
-				}
-
-				defer queue.Done(key)
-				klog.Infof("Calling Deployment processItem")
-				err := processItem(key.(string))
-
-				if err == nil {
-					// No error so tell the queue to stop tracking history
-					queue.Forget(key)
-				} else if _, ok := err.(*errortypes.NonRetryableError); ok {
-					klog.Errorf("nonRetryableError with message: \"%v\"", err)
-					queue.Forget(key)
-				} else if queue.NumRequeues(key) < maxRetries {
-					klog.Infof("Retrying - failed with message: \"%v\"", err)
-					// requeue the item to work on later
-					queue.AddRateLimited(key)
-				} else {
-					// err != nil and too many retries
-					klog.Errorf("Exhausted all %v retries for route %s with error: \"%v\"", maxRetries, key, err)
-					queue.Forget(key)
-					utilruntime.HandleError(err)
-				}
-
-				return true
-			}()
-		}
-	}
-}
-
-func (c *Controller) processPod(key string) error {
-	//klog.Infof("Inside processPod")
-	//klog.Infof("Key - %s", key)
-	obj, exists, err := c.PodInformer.GetIndexer().GetByKey(key)
-	if err != nil {
-		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
-	}
-	if !exists {
-
-	}
-	// no need to differentiate between creates and updates
-	//klog.Infof("Calling UpdatePod")
-	if err := c.UpdatePod(obj, false); err != nil {
-		return err
-	}
-
-	return nil
-}
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	deploymentconfigv1client "github.com/openshift/client-go/apps/clientset/versioned"
+	routev1client "github.com/openshift/client-go/route/clientset/versioned"
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/am"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/gslb"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/lb"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	//podv1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+type Controller struct {
+	DeploymentConfigClient   deploymentconfigv1client.Interface
+	RouteClient              routev1client.Interface
+	KubeClient               kubernetes.Interface
+	DynamicClient            dynamic.Interface
+	DeploymentConfigInformer cache.SharedIndexInformer
+	DeploymentInformer       cache.SharedIndexInformer
+	PodInformer              cache.SharedIndexInformer
+	QuarantineInformer       cache.SharedIndexInformer
+	NodeInformer             cache.SharedIndexInformer
+	ConfigMapInformer        cache.SharedIndexInformer
+	RouteInformer            cache.SharedIndexInformer
+	RouterShardInformer      cache.SharedIndexInformer
+	ReplicaSetInformer       cache.SharedIndexInformer
+	HPAInformer              cache.SharedIndexInformer
+	DeploymentConfigQueue    workqueue.RateLimitingInterface
+	DeploymentQueue          workqueue.RateLimitingInterface
+	PodQueue                 workqueue.RateLimitingInterface
+	QuarantineQueue          workqueue.RateLimitingInterface
+	ConfigMapQueue           workqueue.RateLimitingInterface
+	RouteQueue               workqueue.RateLimitingInterface
+	RouterShardQueue         workqueue.RateLimitingInterface
+	NamespaceLister          v1.NamespaceLister
+	Gocache                  *gocache.Cache
+	Notifier                 Notifier
+	AddressManagement        am.Client
+	GSLB                     gslb.Client
+	LoadBalancer             lb.Client
+	Recorder                 record.EventRecorder
+	Config                   *config.Config
+	// Clock is the time source of every decision, the real clock when nil. The
+	// simulation sets it to follow the timestamps of the recording it replays
+	Clock clock.Clock
+	// Namespace is the namespace the controller runs in, where it keeps the
+	// ConfigMaps it writes
+	Namespace string
+	// ParseConfig parses a reloaded configuration file the same way as at start-up,
+	// including any environment and flag overrides, and validates it
+	ParseConfig func(data []byte) (*config.Config, error)
+	//PodClient        *podv1client.CoreV1Client
+
+	// settingsLock guards Config and Notifier, and the settings reloaded from
+	// ConfigMaps and RouterShards, which are swapped as a whole on every reload
+	settingsLock       sync.RWMutex
+	lookups            map[string]string
+	routerShardLookups map[string]string
+	blacklist          Blacklist
+	blockedImages      map[string]*BlockedImage
+
+	// gslbLock guards the GSLB entries cached in Gocache
+	gslbLock sync.Mutex
+	// nodeLock serializes node remediation, so the cap on the number of nodes
+	// acted on holds across workers
+	nodeLock sync.Mutex
+}
+
+// Run will set up the event handlers for types we are interested in, as well
+// as syncing informer caches and starting workers. It will block until stopCh
+// is closed, at which point it will shutdown the workqueue and wait for
+// workers to finish processing their current work items.
+func (c *Controller) Run(threads int, stopCh <-chan struct{}) error {
+
+	var (
+		waitGroup sync.WaitGroup
+	)
+
+	defer utilruntime.HandleCrash()
+
+	klog.Infof("Starting Pod Controller")
+	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
+		// no worker is running yet, but the queues' delaying goroutines are, and
+		// would otherwise outlive Run
+		c.drainQueues()
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	klog.Infof("Cache sync complete")
+
+	// run 'threads' number of workers to process Route resources
+	for i := 0; i < threads; i++ {
+		createWorker(c.PodQueue, c.processPod, c.maxRetries, stopCh, &waitGroup)
+		createWorker(c.DeploymentQueue, c.processDeployment, c.maxRetries, stopCh, &waitGroup)
+		createWorker(c.DeploymentConfigQueue, c.processDeploymentConfig, c.maxRetries, stopCh, &waitGroup)
+		createWorker(c.QuarantineQueue, c.processQuarantine, c.maxRetries, stopCh, &waitGroup)
+	}
+
+	klog.Infof("Started Pod, Deployment, DeploymentConfig and Quarantine workers")
+
+	if c.RouteInformer != nil {
+		for i := 0; i < threads; i++ {
+			createWorker(c.RouteQueue, c.processRoute, c.maxRetries, stopCh, &waitGroup)
+		}
+		klog.Infof("Started Route workers")
+	}
+
+	// a single worker applies reloads, so they are never applied out of order
+	if c.ConfigMapInformer != nil {
+		createWorker(c.ConfigMapQueue, c.processConfigMap, c.maxRetries, stopCh, &waitGroup)
+		klog.Infof("Started ConfigMap worker for configuration reloads")
+	}
+
+	// a single worker rebuilds the lookups, so they are never swapped out of order
+	if c.RouterShardInformer != nil {
+		createWorker(c.RouterShardQueue, c.processRouterShard, c.maxRetries, stopCh, &waitGroup)
+		klog.Infof("Started RouterShard worker for router shard lookups")
+	}
+
+	// twins are collected even while the mode is disabled, since it can be
+	// changed by a reload while twins are still around
+	waitGroup.Add(1)
+	go func() {
+		c.runDebugTwinGC(stopCh)
+		waitGroup.Done()
+	}()
+	klog.Infof("Started debug twin garbage collection")
+
+	waitGroup.Add(1)
+	go func() {
+		c.runGlobalReconcile(stopCh)
+		waitGroup.Done()
+	}()
+	klog.Infof("Started global reconcile every %v", c.currentConfig().GlobalResyncPeriod.Duration)
+
+	if addr := c.currentConfig().Metrics.Address; len(addr) > 0 {
+		waitGroup.Add(1)
+		go func() {
+			serveMetrics(addr, stopCh)
+			waitGroup.Done()
+		}()
+	}
+
+	<-stopCh
+	c.drainQueues()
+	klog.Infof("Shutting down workers")
+	waitGroup.Wait()
+	return nil
+}
+
+// queues returns every work queue the controller runs workers for.
+func (c *Controller) queues() map[string]workqueue.RateLimitingInterface {
+	queues := map[string]workqueue.RateLimitingInterface{
+		"Pod":              c.PodQueue,
+		"Deployment":       c.DeploymentQueue,
+		"DeploymentConfig": c.DeploymentConfigQueue,
+		"Quarantine":       c.QuarantineQueue,
+	}
+	if c.ConfigMapInformer != nil {
+		queues["ConfigMap"] = c.ConfigMapQueue
+	}
+	if c.RouteInformer != nil {
+		queues["Route"] = c.RouteQueue
+	}
+	if c.RouterShardInformer != nil {
+		queues["RouterShard"] = c.RouterShardQueue
+	}
+	return queues
+}
+
+// drainQueues shuts down every queue. Workers keep processing the keys that are
+// already queued, and stop once their queue is empty, so waiting for the workers
+// after this drains the queues. Keys due later with AddAfter, such as the next
+// step-down, are dropped and picked up again by the informer resync after restart.
+func (c *Controller) drainQueues() {
+	for name, queue := range c.queues() {
+		if pending := queue.Len(); pending > 0 {
+			klog.Infof("Draining %d keys from the %s queue", pending, name)
+		}
+		queue.ShutDown()
+	}
+}
+
+// HasSynced allows us to satisfy the Controller interface
+// by wiring up the informer's HasSynced method to it
+func (c *Controller) HasSynced() bool {
+	return c.PodInformer.HasSynced() && c.DeploymentInformer.HasSynced() && c.DeploymentConfigInformer.HasSynced() &&
+		c.QuarantineInformer.HasSynced() && (c.ConfigMapInformer == nil || c.ConfigMapInformer.HasSynced()) &&
+		(c.NodeInformer == nil || c.NodeInformer.HasSynced()) && (c.RouteInformer == nil || c.RouteInformer.HasSynced()) &&
+		(c.RouterShardInformer == nil || c.RouterShardInformer.HasSynced()) &&
+		(c.ReplicaSetInformer == nil || c.ReplicaSetInformer.HasSynced()) && (c.HPAInformer == nil || c.HPAInformer.HasSynced())
+}
+
+// currentConfig returns the configuration in effect, or the defaults when the
+// controller was built without one. The returned configuration is never modified,
+// a reload swaps in a new one.
+func (c *Controller) currentConfig() *config.Config {
+	c.settingsLock.RLock()
+	defer c.settingsLock.RUnlock()
+	if c.Config == nil {
+		return config.Default()
+	}
+	return c.Config
+}
+
+// now returns the current time of the controller's clock.
+func (c *Controller) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// maxRetries returns how many times a failing key is retried before it is dropped.
+func (c *Controller) maxRetries() int {
+	return c.currentConfig().MaxRetries
+}
+
+// createWorker creates and runs a worker thread that just processes items in the
+// specified queue. The worker will run until stopCh is closed. The worker will be
+// added to the wait group when started and marked done when finished.
+func createWorker(queue workqueue.RateLimitingInterface, reconciler func(key string) error, maxRetries func() int, stopCh <-chan struct{}, waitGroup *sync.WaitGroup) {
+	waitGroup.Add(1)
+	go func() {
+		wait.Until(runWorker(queue, reconciler, maxRetries), time.Second, stopCh)
+		waitGroup.Done()
+	}()
+}
+
+// runWorker retrieves each queued item and takes the necessary
+// handler action based off if the item was created, updated, or deleted
+func runWorker(queue workqueue.RateLimitingInterface, processItem func(key string) error, maxRetries func() int) func() {
+	return func() {
+		for processNextItem(queue, processItem, maxRetries) {
+		}
+	}
+}
+
+// processNextItem waits for the next queued key and processes it, requeueing it
+// rate limited on a retryable error. It returns false once the queue is shut down.
+func processNextItem(queue workqueue.RateLimitingInterface, processItem func(key string) error, maxRetries func() int) bool {
+	key, quit := queue.Get()
+
+	// stop the worker loop if shutdown message was placed in queue
+	if quit {
+		return false
+	}
+
+	defer queue.Done(key)
+	klog.Infof("Calling Deployment processItem")
+	err := processItem(key.(string))
+
+	if err == nil {
+		// No error so tell the queue to stop tracking history
+		queue.Forget(key)
+	} else if _, ok := err.(*errortypes.NonRetryableError); ok {
+		klog.Errorf("nonRetryableError with message: \"%v\"", err)
+		queue.Forget(key)
+	} else if queue.NumRequeues(key) < maxRetries() {
+		klog.Infof("Retrying - failed with message: \"%v\"", err)
+		// requeue the item to work on later
+		queue.AddRateLimited(key)
+	} else {
+		// err != nil and too many retries
+		klog.Errorf("Exhausted all %v retries for route %s with error: \"%v\"", maxRetries(), key, err)
+		queue.Forget(key)
+		utilruntime.HandleError(err)
+	}
+
+	return true
+}
+
+// ProcessQueued processes the keys queued on every queue, including keys queued
+// while doing so, until all of them are empty, and returns how many keys it
+// processed. Keys due later with AddAfter or AddRateLimited are left queued. It
+// runs in place of Run's workers, in the caller's goroutine, for the simulation.
+func (c *Controller) ProcessQueued() int {
+	reconcilers := map[string]func(key string) error{
+		"Pod":              c.processPod,
+		"Deployment":       c.processDeployment,
+		"DeploymentConfig": c.processDeploymentConfig,
+		"Quarantine":       c.processQuarantine,
+		"ConfigMap":        c.processConfigMap,
+		"Route":            c.processRoute,
+		"RouterShard":      c.processRouterShard,
+	}
+	queues := c.queues()
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	processed := 0
+	for pending := true; pending; {
+		pending = false
+		for _, name := range names {
+			for queue := queues[name]; queue.Len() > 0; processed++ {
+				processNextItem(queue, reconcilers[name], c.maxRetries)
+				pending = true
+			}
+		}
+	}
+	return processed
+}
+
+func (c *Controller) processPod(key string) error {
+	//klog.Infof("Inside processPod")
+	//klog.Infof("Key - %s", key)
+	obj, exists, err := c.PodInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+
+	}
+	// no need to differentiate between creates and updates
+	//klog.Infof("Calling UpdatePod")
+	if err := c.UpdatePod(obj); err != nil {
+		return err
+	}
+
+	return nil
+}
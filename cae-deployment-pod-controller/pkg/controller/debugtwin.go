@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// PodDebugTwinIndex indexes debug twins by the '<namespace>/<name>' of their
+	// source pod
+	PodDebugTwinIndex = "debugtwin"
+
+	debugTwinLabel             = "xxx.xxx.com/debug-twin"
+	debugTwinSourceAnnotation  = "xxx.xxx.com/debug-twin-source"
+	debugTwinExpiresAnnotation = "xxx.xxx.com/debug-twin-expires"
+)
+
+// isDebugTwin reports whether the pod was created by the controller as a debug twin.
+func isDebugTwin(pod *v1.Pod) bool {
+	_, exists := pod.GetLabels()[debugTwinLabel]
+	return exists
+}
+
+// PodDebugTwinIndexFunc is the index function for PodDebugTwinIndex. It must be
+// added to the pod informer before it is started.
+func PodDebugTwinIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || !isDebugTwin(pod) {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("%s/%s", pod.Namespace, pod.GetAnnotations()[debugTwinSourceAnnotation])}, nil
+}
+
+// debugTwinName is the name of the twin of the pod. It is derived from the source
+// pod so that a twin created but not yet in the informer cache is not created twice.
+func debugTwinName(pod *v1.Pod) string {
+	const suffix, maxLength = "-debug", 253
+	name := pod.Name
+	if len(name)+len(suffix) > maxLength {
+		name = name[:maxLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// hasDebugTwin determines if a twin already exists in the cache for the given source
+// pod, so that every resync of a crash-looping pod does not spawn another copy.
+func (c *Controller) hasDebugTwin(pod *v1.Pod) bool {
+	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	if objs, err := c.PodInformer.GetIndexer().ByIndex(PodDebugTwinIndex, key); err == nil {
+		return len(objs) > 0
+	}
+	// without the index, look the twin up by its name
+	_, exists, err := c.PodInformer.GetIndexer().GetByKey(fmt.Sprintf("%s/%s", pod.Namespace, debugTwinName(pod)))
+	return err == nil && exists
+}
+
+// newDebugTwin builds a standalone copy of the pod whose containers run the configured
+// sleep command instead of their entrypoint. The twin has no owner references and none
+// of the source labels, so it is never selected by a Service or adopted by a controller.
+// It has no init containers, which would run their own entrypoints before the sleep,
+// and no ephemeral containers, which the API server rejects on create.
+func newDebugTwin(pod *v1.Pod, now time.Time, policy config.DebugTwinPolicy) *v1.Pod {
+	twin := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      debugTwinName(pod),
+			Namespace: pod.Namespace,
+			Labels: map[string]string{
+				debugTwinLabel: "true",
+			},
+			Annotations: map[string]string{
+				debugTwinSourceAnnotation:  pod.Name,
+				debugTwinExpiresAnnotation: now.Add(policy.TTL.Duration).UTC().Format(time.RFC3339),
+			},
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+
+	// let the scheduler place the twin, it should not be pinned to the source's node
+	twin.Spec.NodeName = ""
+	twin.Spec.RestartPolicy = v1.RestartPolicyNever
+	twin.Spec.InitContainers = nil
+	twin.Spec.EphemeralContainers = nil
+	for i := range twin.Spec.Containers {
+		container := &twin.Spec.Containers[i]
+		container.Command = append([]string(nil), policy.Command...)
+		container.Args = nil
+		container.LivenessProbe = nil
+		container.ReadinessProbe = nil
+		container.StartupProbe = nil
+	}
+	return twin
+}
+
+// createDebugTwin spawns a sleeping copy of the crashing pod so developers can exec into
+// the exact environment that was failing. It is a no-op if a twin already exists,
+// including one created so recently that it is not in the cache yet.
+func (c *Controller) createDebugTwin(pod *v1.Pod) error {
+	if c.hasDebugTwin(pod) {
+		return nil
+	}
+
+	policy := c.currentConfig().Policy.DebugTwin
+	twin, err := c.KubeClient.CoreV1().Pods(pod.Namespace).Create(newDebugTwin(pod, c.now(), policy))
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating debug twin for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	klog.Infof("Created debug twin %s/%s for crashing pod %s, expires in %v", twin.Namespace, twin.Name, pod.Name, policy.TTL.Duration)
+	return nil
+}
+
+// runDebugTwinGC collects debug twins every GC interval until stopCh is closed.
+// The interval is read again after every pass, so a reloaded interval applies from
+// the next one.
+func (c *Controller) runDebugTwinGC(stopCh <-chan struct{}) {
+	for {
+		c.collectDebugTwins()
+		select {
+		case <-time.After(c.currentConfig().Policy.DebugTwin.GCInterval.Duration):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// collectDebugTwins deletes every debug twin whose TTL annotation has elapsed.
+func (c *Controller) collectDebugTwins() {
+	now := c.now()
+	for _, obj := range c.PodInformer.GetIndexer().List() {
+		twin, ok := obj.(*v1.Pod)
+		if !ok || !isDebugTwin(twin) {
+			continue
+		}
+
+		expires, err := time.Parse(time.RFC3339, twin.GetAnnotations()[debugTwinExpiresAnnotation])
+		if err != nil {
+			klog.Errorf("Invalid expiry on debug twin %s/%s, deleting: %v", twin.Namespace, twin.Name, err)
+		} else if now.Before(expires) {
+			continue
+		}
+
+		if err := c.KubeClient.CoreV1().Pods(twin.Namespace).Delete(twin.Name, &metav1.DeleteOptions{}); err != nil {
+			klog.Errorf("Error deleting expired debug twin %s/%s: %v", twin.Namespace, twin.Name, err)
+			continue
+		}
+		klog.Infof("Deleted expired debug twin %s/%s", twin.Namespace, twin.Name)
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"fmt"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Decision is the outcome of evaluating a crashing pod against the policy. It is
+// computed without side effects, so it can be used both by UpdatePod and to explain
+// to an operator why the controller would or would not act.
+type Decision struct {
+	Pod  string
+	Kind string
+	Name string
+
+	// Act is true when the controller applies or proposes Action on the workload
+	Act    bool
+	Action string
+
+	// Approval is true when the action is only proposed, pending approval
+	Approval bool
+
+	// Quarantine is the open Quarantine for the workload, if any
+	Quarantine *quarantinev1alpha1.Quarantine
+
+	// Node is set when the pod's node, rather than its workload, is blamed for the
+	// crashes; NodeReason explains why
+	Node       string
+	NodeReason string
+
+	// BlockedImage is set when the pod runs an image digest blocked after crash
+	// loops elsewhere; ImageBlocked is true when that alone is reason to act
+	BlockedImage string
+	ImageBlocked bool
+
+	// Reasons explain, in order, how the decision was reached
+	Reasons []string
+}
+
+func (d *Decision) because(format string, a ...interface{}) *Decision {
+	d.Reasons = append(d.Reasons, fmt.Sprintf(format, a...))
+	return d
+}
+
+// Decide evaluates the pod against the policy and returns what the controller would
+// do about it. It only reads from the informer caches.
+func (c *Controller) Decide(pod *v1.Pod) (*Decision, error) {
+	decision := &Decision{Pod: fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)}
+	current := c.currentConfig()
+	policy := current.Policy
+
+	if isDebugTwin(pod) {
+		return decision.because("pod is a debug twin created by the controller"), nil
+	}
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return decision.because("pod has no container statuses yet"), nil
+	}
+	if image, container := c.blockedImageFor(pod, policy.Images); image != nil {
+		decision.BlockedImage = image.Digest
+		decision.ImageBlocked = policy.Images.Action == config.ImageActionAct
+		decision.because("container %s runs a blocked image, %s", container, image.Describe())
+	}
+	// the same check as the quorum and the workload health, over every container
+	if container := crashLoopingContainer(pod, policy.RestartThreshold, policy.Scale.Interval.Duration, c.now()); container != nil {
+		decision.because("container %s exceeded the threshold of %d restarts with %d and is still failing", container.Name, policy.RestartThreshold, container.RestartCount)
+	} else if !decision.ImageBlocked {
+		return decision.because("no container exceeded the threshold of %d restarts and is still failing", policy.RestartThreshold), nil
+	}
+
+	name := workloadNameForPod(pod)
+	if len(name) == 0 {
+		return decision.because("pod has no deployment annotations, 'name' label or DaemonSet/Job owner"), nil
+	}
+	if !config.Contains(policy.WatchedNamespaces, pod.Namespace) {
+		return decision.because("namespace %s is not watched", pod.Namespace), nil
+	}
+	if config.Contains(current.Guardrails.ExcludedNamespaces, pod.Namespace) {
+		return decision.because("namespace %s is excluded by the guardrails", pod.Namespace), nil
+	}
+
+	kind, name, err := c.resolveWorkload(pod, fmt.Sprintf("%s/%s", pod.Namespace, name))
+	if err != nil {
+		return nil, err
+	}
+	if len(kind) == 0 {
+		return decision.because("no DeploymentConfig or Deployment named %s found", name), nil
+	}
+	decision.Kind, decision.Name, decision.Action = kind, name, actionFor(kind, policy.Action)
+	decision.because("pod belongs to %s %s", kind, name)
+
+	quarantine, err := c.openQuarantine(kind, pod.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	decision.Quarantine = quarantine
+	if quarantine != nil && len(quarantine.Status.Phase) == 0 {
+		return decision.because("Quarantine %s has no phase yet", quarantine.Name), nil
+	}
+	if quarantine != nil && quarantine.Status.Phase != quarantinev1alpha1.PhaseActive {
+		return decision.because("Quarantine %s is %s", quarantine.Name, quarantine.Status.Phase), nil
+	}
+	if quarantine == nil && decision.ImageBlocked {
+		decision.because("the blocked image is reason enough, the quorum does not apply")
+	} else if quarantine == nil {
+		// crashes correlated on one node are the node's fault, not the workload's
+		if node, reason := c.blameNode(pod, policy.Node); len(node) > 0 {
+			decision.Node, decision.NodeReason = node, reason
+			return decision.because("%s, the node is blamed and %s %s is left alone", reason, kind, name), nil
+		}
+		if !c.checkQuorum(decision, pod.Namespace) {
+			return decision, nil
+		}
+	}
+
+	if limit := current.Guardrails.MaxActiveQuarantines; quarantine == nil && limit > 0 {
+		active, err := c.activeQuarantines()
+		if err != nil {
+			return nil, err
+		}
+		if active >= limit {
+			return decision.because("%d Quarantines are open, the guardrail allows at most %d", active, limit), nil
+		}
+	}
+
+	decision.Act = true
+	switch {
+	case quarantine != nil:
+		decision.because("Quarantine %s is Active, %s continues", quarantine.Name, decision.Action)
+	case requiresApproval(policy.Approval, pod.Namespace):
+		decision.Approval = true
+		decision.because("namespace %s requires approval, %s is proposed", pod.Namespace, decision.Action)
+	default:
+		decision.because("%s is applied", decision.Action)
+	}
+	return decision, nil
+}
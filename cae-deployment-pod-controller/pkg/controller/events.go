@@ -0,0 +1,34 @@
+package controller
+
+import (
+	routev1 "github.com/openshift/api/route/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// eventComponent is the source of the Events emitted by the controller
+const eventComponent = "deploymentpodctl"
+
+// NewEventRecorder returns a recorder that emits Events through the API server.
+// Routes are registered with the scheme so Events can refer to them.
+func NewEventRecorder(kubeClient kubernetes.Interface) record.EventRecorder {
+	if err := routev1.AddToScheme(scheme.Scheme); err != nil {
+		klog.Errorf("Error registering Routes for Events: %v", err)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent})
+}
+
+// event emits an Event on the object, if the controller has a recorder.
+func (c *Controller) event(obj runtime.Object, eventType, reason, message string) {
+	if c.Recorder != nil {
+		c.Recorder.Event(obj, eventType, reason, message)
+	}
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/webhook"
+	dv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// globalSummary counts what a global reconcile checked and corrected.
+type globalSummary struct {
+	routes                int
+	routeCorrections      int
+	routeErrors           int
+	quarantines           int
+	quarantineCorrections int
+	quarantineErrors      int
+}
+
+func (s globalSummary) String() string {
+	return fmt.Sprintf("routes: %d checked, %d corrected, %d failed; quarantined workloads: %d checked, %d corrected, %d failed",
+		s.routes, s.routeCorrections, s.routeErrors, s.quarantines, s.quarantineCorrections, s.quarantineErrors)
+}
+
+// runGlobalReconcile reconciles everything once every global resync period until
+// stopCh is closed. The first pass waits a full period, since the informers have
+// just delivered every object to the workers.
+func (c *Controller) runGlobalReconcile(stopCh <-chan struct{}) {
+	period := c.currentConfig().GlobalResyncPeriod.Duration
+	select {
+	case <-time.After(period):
+	case <-stopCh:
+		return
+	}
+	wait.Until(c.reconcileGlobal, period, stopCh)
+}
+
+// reconcileGlobal is the global watcher. Unlike the informer resyncs, which only
+// replay the cached objects, it verifies the external systems: every Route is
+// checked against freshly listed GSLB entries, address management and the load
+// balancers, and every Active Quarantine against its workload. Drift is corrected and summarised.
+func (c *Controller) reconcileGlobal() {
+	start := time.Now()
+	summary := globalSummary{}
+
+	if c.RouteInformer != nil {
+		c.forgetGSLBEntries()
+		for _, obj := range c.RouteInformer.GetIndexer().List() {
+			route := obj.(*routev1.Route)
+			summary.routes++
+			corrections, err := c.processGlobalRoute(route)
+			summary.routeCorrections += len(corrections)
+			if err != nil {
+				summary.routeErrors++
+				klog.Warningf("Global reconcile of route %s/%s failed: %v", route.Namespace, route.Name, err)
+			}
+		}
+	}
+
+	for _, obj := range c.QuarantineInformer.GetIndexer().List() {
+		quarantine, err := quarantineFromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			klog.Errorf("%v", err)
+			continue
+		}
+		if quarantine.DeletionTimestamp != nil || quarantine.Status.Phase != quarantinev1alpha1.PhaseActive {
+			continue
+		}
+		summary.quarantines++
+		corrections, err := c.processGlobalQuarantine(quarantine)
+		summary.quarantineCorrections += len(corrections)
+		if err != nil {
+			summary.quarantineErrors++
+			klog.Warningf("Global reconcile of Quarantine %s/%s failed: %v", quarantine.Namespace, quarantine.Name, err)
+		}
+	}
+
+	klog.Infof("Global reconcile finished in %v - %s", time.Since(start).Round(time.Millisecond), summary)
+}
+
+// processGlobalRoute verifies a Route during the global reconcile, running the same
+// sync as the Route workers and then checking its load balancer configuration, and
+// returns the corrections it made.
+func (c *Controller) processGlobalRoute(route *routev1.Route) ([]string, error) {
+	corrections, err := c.syncRoute(route)
+	if err != nil {
+		return corrections, err
+	}
+	lbCorrections, err := c.UpdateGlobalRoute(route)
+	return append(corrections, lbCorrections...), err
+}
+
+// scaledBackUp reports whether a workload is back at or above the replicas it had
+// before the remediation, which step-downs never leave it at.
+func scaledBackUp(replicas int32, originalState map[string]string) bool {
+	original, exists := originalReplicas(originalState)
+	return exists && replicas > 0 && replicas >= original
+}
+
+// isOverridden reports whether the workload carries the override annotation, which
+// the admission webhook lets scale up and roll out while it is quarantined.
+func isOverridden(annotations map[string]string) bool {
+	return annotations[webhook.OverrideAnnotation] == "true"
+}
+
+// processGlobalQuarantine verifies that the workload of an Active Quarantine is
+// still remediated, and applies the remediation again when it was undone without
+// releasing the Quarantine, e.g. while the admission webhook was unavailable. It
+// returns the corrections it made. Workloads overridden by their owners are left
+// alone.
+func (c *Controller) processGlobalQuarantine(quarantine *quarantinev1alpha1.Quarantine) ([]string, error) {
+	workload := quarantine.Spec.Workload
+	key := fmt.Sprintf("%s/%s", quarantine.Namespace, workload.Name)
+	action := quarantine.Spec.Action
+
+	var corrections []string
+	switch workload.Kind {
+	case kindDeployment:
+		obj, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+		}
+		if !exists {
+			return nil, nil
+		}
+		deployment := obj.(*dv1.Deployment)
+		if isOverridden(deployment.GetAnnotations()) {
+			klog.V(4).Infof("Not verifying Quarantine %s/%s, Deployment %s is overridden", quarantine.Namespace, quarantine.Name, key)
+			return nil, nil
+		}
+		if shouldPause(action) && deployment.GetAnnotations()[pausedAnnotation] == "true" && !deployment.Spec.Paused {
+			if deployment, err = c.pauseDeployment(deployment); err != nil {
+				return nil, err
+			}
+			corrections = append(corrections, fmt.Sprintf("paused Deployment %s again", key))
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		if shouldScale(action) && !isSteppingDown(deployment.GetAnnotations()) && scaledBackUp(replicas, quarantine.Spec.OriginalState) {
+			if err := c.stepDownDeployment(deployment); err != nil {
+				return corrections, err
+			}
+			corrections = append(corrections, fmt.Sprintf("stepped Deployment %s down again from %d replicas", key, replicas))
+		}
+
+	case kindDeploymentConfig:
+		obj, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+		}
+		if !exists {
+			return nil, nil
+		}
+		deploymentconfig := obj.(*dcv1.DeploymentConfig)
+		if isOverridden(deploymentconfig.GetAnnotations()) {
+			klog.V(4).Infof("Not verifying Quarantine %s/%s, DeploymentConfig %s is overridden", quarantine.Namespace, quarantine.Name, key)
+			return nil, nil
+		}
+		if _, paused := deploymentconfig.GetAnnotations()[originalTriggersAnnotation]; shouldPause(action) && paused && hasRolloutTriggers(deploymentconfig) {
+			if deploymentconfig, err = c.pauseDeploymentConfig(deploymentconfig); err != nil {
+				return nil, err
+			}
+			corrections = append(corrections, fmt.Sprintf("disabled the triggers of DeploymentConfig %s again", key))
+		}
+		replicas := deploymentconfig.Spec.Replicas
+		if shouldScale(action) && !isSteppingDown(deploymentconfig.GetAnnotations()) && scaledBackUp(replicas, quarantine.Spec.OriginalState) {
+			if err := c.stepDownDeploymentConfig(deploymentconfig); err != nil {
+				return corrections, err
+			}
+			corrections = append(corrections, fmt.Sprintf("stepped DeploymentConfig %s down again from %d replicas", key, replicas))
+		}
+	}
+
+	for _, correction := range corrections {
+		klog.Infof("Quarantine %s/%s was undone, %s", quarantine.Namespace, quarantine.Name, correction)
+		c.notify(quarantine, fmt.Sprintf("%s %s/%s is still quarantined, %s", workload.Kind, quarantine.Namespace, workload.Name, correction))
+	}
+	return corrections, nil
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+
+	v1 "github.com/openshift/api/route/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/gslb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const reasonGSLBUpdated = "GSLBUpdated"
+
+// gslbEntries returns the GSLB entries by hostname. They are listed once per cache
+// TTL and kept in Gocache under gslbCacheKey, rather than fetched for every route.
+// The map is shared, callers must hold gslbLock.
+func (c *Controller) gslbEntries() (map[string]*gslb.Entry, error) {
+	if entries, found := c.Gocache.Get(gslbCacheKey); found {
+		return entries.(map[string]*gslb.Entry), nil
+	}
+
+	list, err := c.GSLB.ListEntries()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*gslb.Entry, len(list))
+	for i := range list {
+		entries[list[i].Hostname] = &list[i]
+	}
+	c.Gocache.Set(gslbCacheKey, entries, c.currentConfig().GSLB.CacheTTL.Duration)
+	klog.V(4).Infof("Cached %d GSLB entries", len(entries))
+	return entries, nil
+}
+
+// gslbMember returns the VIP the hostname's GSLB entry has in the datacenter, or an
+// empty string if it has none.
+func (c *Controller) gslbMember(hostname, datacenter string) (string, error) {
+	c.gslbLock.Lock()
+	defer c.gslbLock.Unlock()
+
+	entries, err := c.gslbEntries()
+	if err != nil {
+		return "", err
+	}
+	if entry, exists := entries[hostname]; exists {
+		return entry.Members[datacenter], nil
+	}
+	return "", nil
+}
+
+// cacheGSLBMember records a member that was set, so the cached entries stay current
+// until they are listed again.
+func (c *Controller) cacheGSLBMember(hostname, datacenter, vip string) {
+	c.gslbLock.Lock()
+	defer c.gslbLock.Unlock()
+
+	cached, found := c.Gocache.Get(gslbCacheKey)
+	if !found {
+		return
+	}
+	entries := cached.(map[string]*gslb.Entry)
+	entry, exists := entries[hostname]
+	if !exists {
+		entry = &gslb.Entry{Hostname: hostname, Members: map[string]string{}}
+		entries[hostname] = entry
+	}
+	entry.Members[datacenter] = vip
+}
+
+// forgetGSLBEntries drops the cached GSLB entries, so they are listed again.
+func (c *Controller) forgetGSLBEntries() {
+	c.gslbLock.Lock()
+	defer c.gslbLock.Unlock()
+	c.Gocache.Delete(gslbCacheKey)
+}
+
+// ensureGSLB makes the GSLB entry of the route's host point at the expected RP in
+// the local datacenter, so the GSLB can fail the route over to this datacenter. It
+// returns what it changed, or an empty string if the entry was already correct.
+func (c *Controller) ensureGSLB(route *v1.Route, expected string) (string, error) {
+	if c.GSLB == nil {
+		return "", nil
+	}
+	hostname, datacenter, vip := route.Spec.Host, c.currentConfig().GSLB.Datacenter, gslb.CanonicalVIP(expected)
+
+	current, err := c.gslbMember(hostname, datacenter)
+	if err != nil {
+		return "", err
+	}
+	if current == vip {
+		return "", nil
+	}
+
+	if err := c.GSLB.SetMember(hostname, datacenter, vip); err != nil {
+		return "", err
+	}
+	c.cacheGSLBMember(hostname, datacenter, vip)
+
+	message := fmt.Sprintf("Pointed the GSLB entry of %s in %s at %s", hostname, datacenter, vip)
+	if len(current) > 0 {
+		message += fmt.Sprintf(" instead of %s", current)
+	}
+	klog.Infof("%s - route: %s/%s", message, route.Namespace, route.Name)
+	c.event(route, corev1.EventTypeNormal, reasonGSLBUpdated, message)
+	return message, nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/gslb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureGSLBCachesEntries(t *testing.T) {
+	fake := gslb.NewFake(
+		gslb.Entry{Hostname: "app.cisco.com", Members: map[string]string{"alln": "rp-b.cisco.com", "rcdn": "rp-c.cisco.com"}},
+		gslb.Entry{Hostname: "other.cisco.com", Members: map[string]string{"alln": "rp-a.cisco.com"}},
+	)
+	fake.Username, fake.Password = "user", "secret"
+	server := httptest.NewServer(fake.Handler())
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.GSLB.Datacenter = "alln"
+	c := &Controller{
+		Config:  cfg,
+		GSLB:    gslb.NewHTTPClient(server.URL, "user", "secret", time.Second),
+		Gocache: gocache.New(time.Hour, time.Hour),
+	}
+
+	// the steps run in order against the same controller and fake
+	steps := []struct {
+		name     string
+		host     string
+		expected string
+		// forget drops the cached entries before the step
+		forget bool
+
+		wantChanged bool
+		wantLists   int
+	}{
+		{
+			name:        "member on the wrong RP is set, listing the entries once",
+			host:        "app.cisco.com",
+			expected:    "rp-a.cisco.com.",
+			wantChanged: true,
+			wantLists:   1,
+		},
+		{
+			name:      "member just set is current in the cache",
+			host:      "app.cisco.com",
+			expected:  "rp-a.cisco.com.",
+			wantLists: 1,
+		},
+		{
+			name:      "member on the expected RP is left alone without listing again",
+			host:      "other.cisco.com",
+			expected:  "rp-a.cisco.com",
+			wantLists: 1,
+		},
+		{
+			name:        "entry missing from the GSLB is created",
+			host:        "new.cisco.com",
+			expected:    "rp-a.cisco.com.",
+			wantChanged: true,
+			wantLists:   1,
+		},
+		{
+			name:      "entries are listed again once forgotten",
+			host:      "new.cisco.com",
+			expected:  "rp-a.cisco.com.",
+			forget:    true,
+			wantLists: 2,
+		},
+	}
+
+	for _, step := range steps {
+		if step.forget {
+			c.forgetGSLBEntries()
+		}
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"},
+			Spec:       routev1.RouteSpec{Host: step.host},
+		}
+		message, err := c.ensureGSLB(route, step.expected)
+		if err != nil {
+			t.Fatalf("%s: ensureGSLB() = %v", step.name, err)
+		}
+		if changed := len(message) > 0; changed != step.wantChanged {
+			t.Errorf("%s: ensureGSLB() = %q, want changed %t", step.name, message, step.wantChanged)
+		}
+		if lists := fake.Lists(); lists != step.wantLists {
+			t.Errorf("%s: entries listed %d times, want %d", step.name, lists, step.wantLists)
+		}
+	}
+
+	entries, _ := fake.ListEntries()
+	want := map[string]map[string]string{
+		"app.cisco.com":   {"alln": "rp-a.cisco.com", "rcdn": "rp-c.cisco.com"},
+		"new.cisco.com":   {"alln": "rp-a.cisco.com"},
+		"other.cisco.com": {"alln": "rp-a.cisco.com"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("GSLB entries = %v, want %v", entries, want)
+	}
+	for _, entry := range entries {
+		for datacenter, vip := range want[entry.Hostname] {
+			if entry.Members[datacenter] != vip || len(entry.Members) != len(want[entry.Hostname]) {
+				t.Errorf("GSLB entry of %s = %v, want %v", entry.Hostname, entry.Members, want[entry.Hostname])
+				break
+			}
+		}
+	}
+}
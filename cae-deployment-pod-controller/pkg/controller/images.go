@@ -0,0 +1,465 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+const (
+	// blockedImagesConfigMap holds the blocked image digests, one key per digest,
+	// in the controller's namespace. Removing a key unblocks the digest.
+	blockedImagesConfigMap = "blocked-images"
+
+	// maxImageEvidence caps the evidence kept per digest, to bound the ConfigMap
+	maxImageEvidence = 10
+
+	reasonBlockedImage = "BlockedImage"
+)
+
+var validDigest = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// BlockedImage is an image digest that crash-looped, with the evidence for it.
+type BlockedImage struct {
+	Digest    string      `json:"digest"`
+	Image     string      `json:"image"`
+	BlockedAt metav1.Time `json:"blockedAt"`
+	// ExpiresAt is when the block lapses, never if unset
+	ExpiresAt *metav1.Time    `json:"expiresAt,omitempty"`
+	Evidence  []ImageEvidence `json:"evidence"`
+	// Note explains blocks added by an operator, which have no evidence
+	Note string `json:"note,omitempty"`
+}
+
+// ImageEvidence is a crash-looping container that ran the blocked digest.
+type ImageEvidence struct {
+	Namespace string      `json:"namespace"`
+	Kind      string      `json:"kind"`
+	Workload  string      `json:"workload"`
+	Pod       string      `json:"pod"`
+	Container string      `json:"container"`
+	Restarts  int32       `json:"restarts"`
+	Reason    string      `json:"reason,omitempty"`
+	ExitCode  int32       `json:"exitCode"`
+	SeenAt    metav1.Time `json:"seenAt"`
+}
+
+// Workloads lists the workloads in the evidence as '<namespace>/<name>'.
+func (b *BlockedImage) Workloads() []string {
+	var workloads []string
+	for _, evidence := range b.Evidence {
+		key := fmt.Sprintf("%s/%s", evidence.Namespace, evidence.Workload)
+		if !config.Contains(workloads, key) {
+			workloads = append(workloads, key)
+		}
+	}
+	return workloads
+}
+
+// Expired reports whether the block has lapsed.
+func (b *BlockedImage) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(b.ExpiresAt.Time)
+}
+
+// blocks reports whether the block applies to the workload, given as
+// '<namespace>/<name>'. Blocks from crash loops apply to every other workload,
+// blocks added by an operator to all of them.
+func (b *BlockedImage) blocks(workload string) bool {
+	if len(b.Evidence) == 0 {
+		return true
+	}
+	for _, other := range b.Workloads() {
+		if other != workload {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe explains the block in a sentence, for Events and admission responses.
+func (b *BlockedImage) Describe() string {
+	description := fmt.Sprintf("image %s", b.Digest)
+	if len(b.Image) > 0 {
+		description += fmt.Sprintf(" (%s)", b.Image)
+	}
+	if len(b.Evidence) > 0 {
+		description += fmt.Sprintf(" is blocked after crash loops in %s", strings.Join(b.Workloads(), ", "))
+	} else {
+		description += " is blocked"
+	}
+	if len(b.Note) > 0 {
+		description += fmt.Sprintf(" (%s)", b.Note)
+	}
+	if b.ExpiresAt != nil {
+		description += fmt.Sprintf(" until %s", b.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return description
+}
+
+// imageDigest extracts the digest from a container status' ImageID, which depends
+// on the runtime, e.g. 'docker-pullable://registry/repo@sha256:...'. It returns an
+// empty string when there is no digest.
+func imageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		imageID = imageID[i+1:]
+	}
+	imageID = strings.TrimPrefix(imageID, "docker://")
+	if !strings.HasPrefix(imageID, "sha256:") {
+		return ""
+	}
+	return imageID
+}
+
+// digestKey returns the ConfigMap key of the digest, since keys cannot contain ':'.
+func digestKey(digest string) string {
+	return strings.Replace(digest, ":", ".", 1)
+}
+
+// parseBlockedImages parses the blocked images ConfigMap data, returning the images
+// by digest and any invalid entries.
+func parseBlockedImages(data map[string]string) (map[string]*BlockedImage, []string) {
+	images := map[string]*BlockedImage{}
+	var errs []string
+	for key, value := range data {
+		image := &BlockedImage{}
+		if err := json.Unmarshal([]byte(value), image); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		if digestKey(image.Digest) != key {
+			errs = append(errs, fmt.Sprintf("%s: digest %q does not match the key", key, image.Digest))
+			continue
+		}
+		images[image.Digest] = image
+	}
+	return images, errs
+}
+
+// currentBlockedImages returns the blocked images by digest.
+func (c *Controller) currentBlockedImages() map[string]*BlockedImage {
+	c.settingsLock.RLock()
+	defer c.settingsLock.RUnlock()
+	return c.blockedImages
+}
+
+// reloadBlockedImages swaps in the blocked images from the blocked images ConfigMap,
+// so operators can unblock a digest by removing its key.
+func (c *Controller) reloadBlockedImages(configMap *v1.ConfigMap) (string, error) {
+	parsed, errs := parseBlockedImages(configMap.Data)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid blocked images:\n  %s", strings.Join(errs, "\n  "))
+	}
+	if equality.Semantic.DeepEqual(c.currentBlockedImages(), parsed) {
+		return "", nil
+	}
+
+	c.settingsLock.Lock()
+	c.blockedImages = parsed
+	c.settingsLock.Unlock()
+	return fmt.Sprintf("Reloaded %d blocked image digests", len(parsed)), nil
+}
+
+// blockedImageFor returns the first blocked digest one of the pod's containers runs,
+// along with the container name, unless the block has expired or only comes from
+// the pod's own workload, whose crash loops are handled by the restart threshold.
+func (c *Controller) blockedImageFor(pod *v1.Pod, policy config.ImagePolicy) (*BlockedImage, string) {
+	if policy.Action == config.ImageActionDisabled {
+		return nil, ""
+	}
+	images := c.currentBlockedImages()
+	if len(images) == 0 {
+		return nil, ""
+	}
+
+	now := c.now()
+	workload := fmt.Sprintf("%s/%s", pod.Namespace, workloadNameForPod(pod))
+	for _, status := range pod.Status.ContainerStatuses {
+		image, blocked := images[imageDigest(status.ImageID)]
+		if blocked && !image.Expired(now) && image.blocks(workload) {
+			return image, status.Name
+		}
+	}
+	return nil, ""
+}
+
+// warnBlockedImage emits a Warning Event on a pod running a blocked digest, at most
+// once per pod and digest while the entry stays in the cache.
+func (c *Controller) warnBlockedImage(pod *v1.Pod, decision *Decision) {
+	key := fmt.Sprintf("blocked-image/%s/%s/%s", pod.Namespace, pod.Name, decision.BlockedImage)
+	if c.Gocache != nil && c.Gocache.Add(key, true, gocache.DefaultExpiration) != nil {
+		return
+	}
+	image := c.currentBlockedImages()[decision.BlockedImage]
+	if image == nil {
+		return
+	}
+	message := fmt.Sprintf("Runs blocked image, %s", image.Describe())
+	klog.Warningf("Pod %s - %s", decision.Pod, message)
+	c.event(pod, v1.EventTypeWarning, reasonBlockedImage, message)
+}
+
+// blockImages blocks the digests of the pod's crash-looping containers, recording
+// the workload as evidence. Known evidence is not updated, so the ConfigMap is only
+// written when something new is learned. The evidence is merged into the ConfigMap,
+// retrying on conflicts so concurrent workers do not lose each other's evidence, and
+// the blocks only take effect in memory once they are saved.
+func (c *Controller) blockImages(decision *Decision, pod *v1.Pod) error {
+	policy := c.currentConfig().Policy
+	if policy.Images.Action == config.ImageActionDisabled {
+		return nil
+	}
+
+	now := metav1.NewTime(c.now())
+	type crashing struct {
+		digest, image string
+		evidence      ImageEvidence
+	}
+	var found []crashing
+	for _, status := range pod.Status.ContainerStatuses {
+		digest := imageDigest(status.ImageID)
+		if len(digest) == 0 || !containerCrashLooping(status, policy.RestartThreshold, policy.Scale.Interval.Duration, now.Time) {
+			continue
+		}
+		evidence := ImageEvidence{
+			Namespace: pod.Namespace,
+			Kind:      decision.Kind,
+			Workload:  decision.Name,
+			Pod:       pod.Name,
+			Container: status.Name,
+			Restarts:  status.RestartCount,
+			SeenAt:    now,
+		}
+		if last := status.LastTerminationState.Terminated; last != nil {
+			evidence.Reason, evidence.ExitCode = last.Reason, last.ExitCode
+		}
+		found = append(found, crashing{digest: digest, image: status.Image, evidence: evidence})
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	// merge returns the images whose evidence grows, based on the current blocks
+	merge := func(current map[string]*BlockedImage) map[string]*BlockedImage {
+		changed := map[string]*BlockedImage{}
+		for _, container := range found {
+			image, pending := changed[container.digest]
+			if !pending {
+				if existing, blocked := current[container.digest]; blocked && !existing.Expired(now.Time) {
+					image = existing.DeepCopy()
+				} else {
+					image = newBlockedImage(container.digest, container.image, now, policy.Images.TTL.Duration)
+				}
+			}
+			if image.addEvidence(container.evidence) {
+				changed[container.digest] = image
+			}
+		}
+		return changed
+	}
+
+	var changed map[string]*BlockedImage
+	if len(c.Namespace) == 0 {
+		klog.Warning("POD_NAMESPACE is not set, blocked images are not saved")
+		changed = merge(c.currentBlockedImages())
+	} else if err := c.updateBlockedImagesConfigMap(func(data map[string]string) (bool, error) {
+		current, _ := parseBlockedImages(data)
+		changed = merge(current)
+		for _, image := range changed {
+			encoded, err := json.Marshal(image)
+			if err != nil {
+				return false, err
+			}
+			data[digestKey(image.Digest)] = string(encoded)
+		}
+		return len(changed) > 0, nil
+	}); err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	c.settingsLock.Lock()
+	blocked := make(map[string]*BlockedImage, len(c.blockedImages)+len(changed))
+	for digest, image := range c.blockedImages {
+		blocked[digest] = image
+	}
+	for digest, image := range changed {
+		blocked[digest] = image
+		klog.Infof("Blocked image %s (%s) after crash loops in %s", image.Digest, image.Image, strings.Join(image.Workloads(), ", "))
+	}
+	c.blockedImages = blocked
+	c.settingsLock.Unlock()
+	return nil
+}
+
+// newBlockedImage returns a block of the digest expiring after ttl, or never if
+// ttl is zero.
+func newBlockedImage(digest, image string, now metav1.Time, ttl time.Duration) *BlockedImage {
+	blocked := &BlockedImage{Digest: digest, Image: image, BlockedAt: now}
+	if ttl > 0 {
+		expiresAt := metav1.NewTime(now.Add(ttl))
+		blocked.ExpiresAt = &expiresAt
+	}
+	return blocked
+}
+
+// addEvidence adds the evidence unless the same workload container is already
+// known, dropping the oldest evidence beyond maxImageEvidence. It reports whether
+// the evidence was added.
+func (b *BlockedImage) addEvidence(evidence ImageEvidence) bool {
+	for _, known := range b.Evidence {
+		if known.Namespace == evidence.Namespace && known.Workload == evidence.Workload && known.Container == evidence.Container {
+			return false
+		}
+	}
+	b.Evidence = append(b.Evidence, evidence)
+	if len(b.Evidence) > maxImageEvidence {
+		b.Evidence = b.Evidence[len(b.Evidence)-maxImageEvidence:]
+	}
+	return true
+}
+
+// DeepCopy returns a copy of the blocked image that can be modified.
+func (b *BlockedImage) DeepCopy() *BlockedImage {
+	copy := *b
+	copy.Evidence = append([]ImageEvidence(nil), b.Evidence...)
+	if b.ExpiresAt != nil {
+		expiresAt := *b.ExpiresAt
+		copy.ExpiresAt = &expiresAt
+	}
+	return &copy
+}
+
+// updateBlockedImagesConfigMap applies update to the data of the blocked images
+// ConfigMap and writes it back if update reports a change, creating the ConfigMap
+// if needed. On a conflict, or if another writer created it first, update is
+// applied again to the latest ConfigMap.
+func (c *Controller) updateBlockedImagesConfigMap(update func(data map[string]string) (bool, error)) error {
+	if len(c.Namespace) == 0 {
+		return fmt.Errorf("the controller's namespace is unknown, set POD_NAMESPACE")
+	}
+	configMaps := c.KubeClient.CoreV1().ConfigMaps(c.Namespace)
+	var updateErr error
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(blockedImagesConfigMap, metav1.GetOptions{})
+		notFound := errors.IsNotFound(err)
+		if err != nil && !notFound {
+			return err
+		}
+		if notFound {
+			configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: blockedImagesConfigMap, Namespace: c.Namespace}}
+		} else {
+			configMap = configMap.DeepCopy()
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+
+		var changed bool
+		if changed, updateErr = update(configMap.Data); updateErr != nil || !changed {
+			return nil
+		}
+		if notFound {
+			_, err = configMaps.Create(configMap)
+			if errors.IsAlreadyExists(err) {
+				// retried like a conflict, against the ConfigMap created meanwhile
+				return errors.NewConflict(v1.Resource("configmaps"), blockedImagesConfigMap, err)
+			}
+			return err
+		}
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error saving ConfigMap %s/%s: %v", c.Namespace, blockedImagesConfigMap, err)
+	}
+	return updateErr
+}
+
+// BlockedImages lists the blocked images from the API, most recently blocked first.
+func (c *Controller) BlockedImages() ([]*BlockedImage, error) {
+	if len(c.Namespace) == 0 {
+		return nil, fmt.Errorf("the controller's namespace is unknown, set POD_NAMESPACE")
+	}
+	configMap, err := c.KubeClient.CoreV1().ConfigMaps(c.Namespace).Get(blockedImagesConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching ConfigMap %s/%s: %v", c.Namespace, blockedImagesConfigMap, err)
+	}
+
+	parsed, errs := parseBlockedImages(configMap.Data)
+	for _, err := range errs {
+		klog.Warningf("Skipping invalid blocked image %s", err)
+	}
+	images := make([]*BlockedImage, 0, len(parsed))
+	for _, image := range parsed {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[j].BlockedAt.Before(&images[i].BlockedAt)
+	})
+	return images, nil
+}
+
+// BlockImage blocks the digest on behalf of an operator, for the configured TTL.
+// Blocks added this way apply to every workload, and replace any existing block of
+// the digest.
+func (c *Controller) BlockImage(digest, image, note string) error {
+	if !validDigest.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q, expected sha256:<64 hex characters>", digest)
+	}
+	blocked := newBlockedImage(digest, image, metav1.Now(), c.currentConfig().Policy.Images.TTL.Duration)
+	blocked.Note = note
+	return c.updateBlockedImagesConfigMap(func(data map[string]string) (bool, error) {
+		encoded, err := json.Marshal(blocked)
+		if err != nil {
+			return false, err
+		}
+		data[digestKey(digest)] = string(encoded)
+		return true, nil
+	})
+}
+
+// UnblockImage removes the block of the digest.
+func (c *Controller) UnblockImage(digest string) error {
+	return c.updateBlockedImagesConfigMap(func(data map[string]string) (bool, error) {
+		if _, blocked := data[digestKey(digest)]; !blocked {
+			return false, fmt.Errorf("image %s is not blocked", digest)
+		}
+		delete(data, digestKey(digest))
+		return true, nil
+	})
+}
+
+// PruneBlockedImages removes the expired blocks and returns their digests.
+func (c *Controller) PruneBlockedImages() ([]string, error) {
+	var pruned []string
+	err := c.updateBlockedImagesConfigMap(func(data map[string]string) (bool, error) {
+		parsed, _ := parseBlockedImages(data)
+		now := c.now()
+		for digest, image := range parsed {
+			if image.Expired(now) {
+				delete(data, digestKey(digest))
+				pruned = append(pruned, digest)
+			}
+		}
+		sort.Strings(pruned)
+		return len(pruned) > 0, nil
+	})
+	return pruned, err
+}
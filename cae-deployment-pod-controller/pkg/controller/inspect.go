@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResolveKind finds the kind of the named workload, checking the informer caches
+// for DeploymentConfigs and Deployments and the API for the other kinds.
+func (c *Controller) ResolveKind(namespace, name string) (string, error) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if _, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key); err != nil || exists {
+		return kindDeploymentConfig, err
+	}
+	if _, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key); err != nil || exists {
+		return kindDeployment, err
+	}
+
+	lookups := []struct {
+		kind string
+		get  func() error
+	}{
+		{kindDaemonSet, func() error {
+			_, err := c.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+			return err
+		}},
+		{kindJob, func() error {
+			_, err := c.KubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+			return err
+		}},
+		{kindCronJob, func() error {
+			_, err := c.KubeClient.BatchV1beta1().CronJobs(namespace).Get(name, metav1.GetOptions{})
+			return err
+		}},
+	}
+	for _, lookup := range lookups {
+		err := lookup.get()
+		if err == nil {
+			return lookup.kind, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("No workload named %s found", key)
+}
+
+// WorkloadPods returns the pods of the workload of the kind and name from the
+// informer cache.
+func (c *Controller) WorkloadPods(kind, namespace, name string) []*v1.Pod {
+	return c.podsForWorkload(kind, namespace, name)
+}
+
+// Policy describes the settings the controller applies to workloads in the namespace.
+func (c *Controller) Policy(namespace string) []string {
+	current := c.currentConfig()
+	policy := current.Policy
+	return []string{
+		fmt.Sprintf("watched namespaces: %s (this namespace %t)", strings.Join(policy.WatchedNamespaces, ", "), config.Contains(policy.WatchedNamespaces, namespace)),
+		fmt.Sprintf("excluded by guardrails: %t", config.Contains(current.Guardrails.ExcludedNamespaces, namespace)),
+		fmt.Sprintf("restart threshold: %d", policy.RestartThreshold),
+		fmt.Sprintf("quorum: %d replicas or %d%% of current-revision pods", policy.Quorum.MinReplicas, policy.Quorum.Percent),
+		fmt.Sprintf("remediation action: %s", policy.Action),
+		fmt.Sprintf("scale strategy: %s (step %d, floor %d, interval %v)", policy.Scale.Strategy, policy.Scale.Step, policy.Scale.Floor, policy.Scale.Interval.Duration),
+		fmt.Sprintf("approval required: %t (timeout %v, default %s)", requiresApproval(policy.Approval, namespace), policy.Approval.Timeout.Duration, policy.Approval.TimeoutDecision),
+		fmt.Sprintf("debug twin: %s (ttl %v)", policy.DebugTwin.Mode, policy.DebugTwin.TTL.Duration),
+		fmt.Sprintf("node correlation: %s (%d workloads, at most %d nodes)", policy.Node.Action, policy.Node.MinWorkloads, policy.Node.MaxNodes),
+		fmt.Sprintf("blocked images: %s (%d digests blocked)", policy.Images.Action, len(c.currentBlockedImages())),
+	}
+}
+
+// Quarantines lists Quarantines from the API, across all namespaces when namespace
+// is empty.
+func (c *Controller) Quarantines(namespace string) ([]*quarantinev1alpha1.Quarantine, error) {
+	list, err := c.DynamicClient.Resource(quarantinev1alpha1.Resource).Namespace(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing Quarantines: %v", err)
+	}
+
+	quarantines := make([]*quarantinev1alpha1.Quarantine, 0, len(list.Items))
+	for i := range list.Items {
+		quarantine, err := quarantineFromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		quarantines = append(quarantines, quarantine)
+	}
+	return quarantines, nil
+}
+
+// Release restores the workload. If it has an Active Quarantine, spec.release is set
+// on it instead and the Quarantine is returned: the admission webhook denies anyone
+// but the controller bringing the workload back while the Quarantine is Active, so
+// the controller restores it and moves the Quarantine to Released.
+func (c *Controller) Release(kind, namespace, name string) (*quarantinev1alpha1.Quarantine, error) {
+	quarantines, err := c.Quarantines(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, quarantine := range quarantines {
+		workload := quarantine.Spec.Workload
+		if workload.Kind == kind && workload.Name == name && quarantine.Status.Phase == quarantinev1alpha1.PhaseActive {
+			quarantine.Spec.Release = true
+			return c.updateQuarantine(quarantine)
+		}
+	}
+	return nil, c.RestoreWorkload(kind, namespace, name)
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	dv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	kindDaemonSet = "DaemonSet"
+	kindJob       = "Job"
+	kindCronJob   = "CronJob"
+
+	actionHaltRollout = "halt-rollout"
+	actionStopJob     = "stop-job"
+
+	originalUpdateStrategyAnnotation = "xxx.xxx.com/original-update-strategy"
+	originalParallelismAnnotation    = "xxx.xxx.com/original-parallelism"
+	suspendedAnnotation              = "xxx.xxx.com/suspended"
+	stoppedReasonAnnotation          = "xxx.xxx.com/stopped-reason"
+)
+
+// haltDaemonSet switches the DaemonSet to the OnDelete update strategy so the rollout
+// stops replacing healthy pods with the crashing revision. The original strategy is
+// saved in an annotation for restore.
+func (c *Controller) haltDaemonSet(namespace, name string) error {
+	daemonset, err := c.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error fetching DaemonSet %s/%s: %v", namespace, name, err)
+	}
+	if _, exists := daemonset.GetAnnotations()[originalUpdateStrategyAnnotation]; exists {
+		return nil
+	}
+
+	original, err := json.Marshal(daemonset.Spec.UpdateStrategy)
+	if err != nil {
+		return fmt.Errorf("Error saving update strategy of DaemonSet %s/%s: %v", namespace, name, err)
+	}
+
+	copy := daemonset.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[originalUpdateStrategyAnnotation] = string(original)
+	copy.SetAnnotations(annotations)
+	copy.Spec.UpdateStrategy = dv1.DaemonSetUpdateStrategy{Type: dv1.OnDeleteDaemonSetStrategyType}
+
+	klog.Infof("Halting rollout of DaemonSet %s/%s", namespace, name)
+	if _, err := c.KubeClient.AppsV1().DaemonSets(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error halting DaemonSet %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// stopJob stops a failing Job from being retried forever by setting its parallelism
+// to zero and recording why. If the Job was created by a CronJob, the CronJob is
+// suspended as well so the next schedule does not start another failing Job.
+func (c *Controller) stopJob(namespace, name, reason string) error {
+	job, err := c.KubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error fetching Job %s/%s: %v", namespace, name, err)
+	}
+
+	if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == kindCronJob {
+		if err := c.suspendCronJob(namespace, owner.Name); err != nil {
+			return err
+		}
+	}
+
+	if _, exists := job.GetAnnotations()[originalParallelismAnnotation]; exists {
+		return nil
+	}
+
+	// a nil parallelism defaults to 1
+	parallelism := int32(1)
+	if job.Spec.Parallelism != nil {
+		parallelism = *job.Spec.Parallelism
+	}
+
+	copy := job.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[originalParallelismAnnotation] = strconv.Itoa(int(parallelism))
+	annotations[stoppedReasonAnnotation] = reason
+	copy.SetAnnotations(annotations)
+	stopped := int32(0)
+	copy.Spec.Parallelism = &stopped
+
+	klog.Infof("Stopping Job %s/%s", namespace, name)
+	if _, err := c.KubeClient.BatchV1().Jobs(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error stopping Job %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// suspendCronJob sets spec.suspend on the CronJob. A CronJob that was already
+// suspended by someone else is left untouched so restore does not resume it.
+func (c *Controller) suspendCronJob(namespace, name string) error {
+	cronjob, err := c.KubeClient.BatchV1beta1().CronJobs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error fetching CronJob %s/%s: %v", namespace, name, err)
+	}
+	if cronjob.Spec.Suspend != nil && *cronjob.Spec.Suspend {
+		return nil
+	}
+
+	copy := cronjob.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[suspendedAnnotation] = "true"
+	copy.SetAnnotations(annotations)
+	suspend := true
+	copy.Spec.Suspend = &suspend
+
+	klog.Infof("Suspending CronJob %s/%s", namespace, name)
+	if _, err := c.KubeClient.BatchV1beta1().CronJobs(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error suspending CronJob %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// restoreDaemonSet puts back the update strategy saved by haltDaemonSet.
+func (c *Controller) restoreDaemonSet(namespace, name string) error {
+	daemonset, err := c.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fetchError(kindDaemonSet, namespace, name, err)
+	}
+	original, exists := daemonset.GetAnnotations()[originalUpdateStrategyAnnotation]
+	if !exists {
+		return nil
+	}
+
+	copy := daemonset.DeepCopy()
+	if err := json.Unmarshal([]byte(original), &copy.Spec.UpdateStrategy); err != nil {
+		return fmt.Errorf("Error parsing %s annotation of DaemonSet %s/%s: %v", originalUpdateStrategyAnnotation, namespace, name, err)
+	}
+	delete(copy.Annotations, originalUpdateStrategyAnnotation)
+
+	klog.Infof("Restoring update strategy of DaemonSet %s/%s", namespace, name)
+	if _, err := c.KubeClient.AppsV1().DaemonSets(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error restoring DaemonSet %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// restoreJob puts back the parallelism saved by stopJob, and resumes the CronJob
+// that created the Job if stopJob suspended it.
+func (c *Controller) restoreJob(namespace, name string) error {
+	job, err := c.KubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fetchError(kindJob, namespace, name, err)
+	}
+	original, exists := job.GetAnnotations()[originalParallelismAnnotation]
+	if !exists {
+		return nil
+	}
+	parallelism, err := strconv.Atoi(original)
+	if err != nil {
+		return fmt.Errorf("Error parsing %s annotation of Job %s/%s: %v", originalParallelismAnnotation, namespace, name, err)
+	}
+
+	copy := job.DeepCopy()
+	restored := int32(parallelism)
+	copy.Spec.Parallelism = &restored
+	delete(copy.Annotations, originalParallelismAnnotation)
+	delete(copy.Annotations, stoppedReasonAnnotation)
+
+	klog.Infof("Restoring Job %s/%s to parallelism %d", namespace, name, restored)
+	if _, err := c.KubeClient.BatchV1().Jobs(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error restoring Job %s/%s: %v", namespace, name, err)
+	}
+
+	if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == kindCronJob {
+		return c.resumeCronJob(namespace, owner.Name)
+	}
+	return nil
+}
+
+// resumeCronJob clears spec.suspend if it was set by suspendCronJob.
+func (c *Controller) resumeCronJob(namespace, name string) error {
+	cronjob, err := c.KubeClient.BatchV1beta1().CronJobs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fetchError(kindCronJob, namespace, name, err)
+	}
+	if cronjob.GetAnnotations()[suspendedAnnotation] != "true" {
+		return nil
+	}
+
+	copy := cronjob.DeepCopy()
+	suspend := false
+	copy.Spec.Suspend = &suspend
+	delete(copy.Annotations, suspendedAnnotation)
+
+	klog.Infof("Resuming CronJob %s/%s", namespace, name)
+	if _, err := c.KubeClient.BatchV1beta1().CronJobs(namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error resuming CronJob %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/lb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const reasonLoadBalancerCorrected = "LoadBalancerCorrected"
+
+// rpAddresses returns the IPs of the RP, resolved once per cache expiration and
+// kept in Gocache under ipCacheKey.
+func (c *Controller) rpAddresses(rp string) ([]string, error) {
+	key := fmt.Sprintf("%s/%s", ipCacheKey, rp)
+	if addresses, found := c.Gocache.Get(key); found {
+		return addresses.([]string), nil
+	}
+
+	addresses, err := net.LookupHost(strings.TrimSuffix(rp, "."))
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving the IP of RP %s: %v", rp, err)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("RP %s has no IP", rp)
+	}
+	sort.Strings(addresses)
+	c.Gocache.Set(key, addresses, gocache.DefaultExpiration)
+	return addresses, nil
+}
+
+// expectedIP returns the IP a load balancer object should have, keeping its
+// current one if it is one of the RP's.
+func expectedIP(current string, addresses []string) string {
+	for _, address := range addresses {
+		if address == current {
+			return current
+		}
+	}
+	return addresses[0]
+}
+
+// changed returns the expected value if it differs from the current one, and
+// nothing otherwise, so that only the changes are sent to the load balancer.
+func changed(current, expected string) string {
+	if current == expected {
+		return ""
+	}
+	return expected
+}
+
+// lbCorrection logs, records an Event for and meters a load balancer correction.
+func (c *Controller) lbCorrection(route *routev1.Route, object, message string) {
+	klog.Infof("%s - route: %s/%s", message, route.Namespace, route.Name)
+	c.event(route, corev1.EventTypeNormal, reasonLoadBalancerCorrected, message)
+	lbCorrectionsTotal.WithLabelValues(object).Inc()
+}
+
+// UpdateGlobalRoute fetches the service and monitor netscaler configurations for a given
+// route host, and makes sure that their IP's correspond to expected IP's (whatever IP
+// the expected RP resolves to). Will ONLY send the IPs and serviceNames that changed,
+// meaning all other configuration parameters will remain the same. Hosts without a
+// service or monitor are left alone. It returns the corrections it made.
+func (c *Controller) UpdateGlobalRoute(route *routev1.Route) ([]string, error) {
+	cname := route.Spec.Host
+	if c.LoadBalancer == nil || len(cname) == 0 || c.isBlackListed(cname, route) {
+		return nil, nil
+	}
+
+	expected, err := c.lookupRP(route)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := c.rpAddresses(expected)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := strings.TrimSuffix(expected, ".")
+
+	var corrections []string
+	service, err := c.LoadBalancer.GetService(cname)
+	if err != nil {
+		return nil, err
+	}
+	if service != nil {
+		if ip := expectedIP(service.IP, addresses); service.IP != ip || service.ServiceName != serviceName {
+			update := &lb.Service{Name: cname}
+			update.ServiceName, update.IP = changed(service.ServiceName, serviceName), changed(service.IP, ip)
+			if err := c.LoadBalancer.UpdateService(update); err != nil {
+				return nil, err
+			}
+			message := fmt.Sprintf("Corrected load balancer service %s from %s (%s) to %s (%s)", cname, service.ServiceName, service.IP, serviceName, ip)
+			c.lbCorrection(route, "service", message)
+			corrections = append(corrections, message)
+		}
+	}
+
+	monitor, err := c.LoadBalancer.GetMonitor(cname)
+	if err != nil {
+		return corrections, err
+	}
+	if monitor != nil {
+		if ip := expectedIP(monitor.IP, addresses); monitor.IP != ip || monitor.ServiceName != serviceName {
+			update := &lb.Monitor{Name: cname}
+			update.ServiceName, update.IP = changed(monitor.ServiceName, serviceName), changed(monitor.IP, ip)
+			if err := c.LoadBalancer.UpdateMonitor(update); err != nil {
+				return corrections, err
+			}
+			message := fmt.Sprintf("Corrected load balancer monitor %s from %s (%s) to %s (%s)", cname, monitor.ServiceName, monitor.IP, serviceName, ip)
+			c.lbCorrection(route, "monitor", message)
+			corrections = append(corrections, message)
+		}
+	}
+	return corrections, nil
+}
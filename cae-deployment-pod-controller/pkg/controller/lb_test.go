@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	gocache "github.com/patrickmn/go-cache"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/lb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestUpdateGlobalRoutePreservesSettings(t *testing.T) {
+	const cname = "app.cisco.com"
+	serviceSettings := map[string]interface{}{"port": float64(443), "lbmethod": "ROUNDROBIN"}
+	monitorSettings := map[string]interface{}{"type": "HTTP-ECV", "interval": float64(5)}
+
+	tests := []struct {
+		name    string
+		service *lb.Service
+		monitor *lb.Monitor
+
+		wantService     *lb.Service
+		wantMonitor     *lb.Monitor
+		wantCorrections int
+	}{
+		{
+			name:            "service and monitor on another RP are pointed at the expected one",
+			service:         &lb.Service{Name: cname, ServiceName: "rp-b.cisco.com", IP: "10.0.0.9", Settings: serviceSettings},
+			monitor:         &lb.Monitor{Name: cname, ServiceName: "rp-b.cisco.com", IP: "10.0.0.9", Settings: monitorSettings},
+			wantService:     &lb.Service{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.1", Settings: serviceSettings},
+			wantMonitor:     &lb.Monitor{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.1", Settings: monitorSettings},
+			wantCorrections: 2,
+		},
+		{
+			name:            "any IP of the expected RP is kept, only the service name is corrected",
+			service:         &lb.Service{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.3", Settings: serviceSettings},
+			monitor:         &lb.Monitor{Name: cname, ServiceName: "rp-b.cisco.com", IP: "10.0.0.3", Settings: monitorSettings},
+			wantService:     &lb.Service{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.3", Settings: serviceSettings},
+			wantMonitor:     &lb.Monitor{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.3", Settings: monitorSettings},
+			wantCorrections: 1,
+		},
+		{
+			name:        "host without a service or monitor is left alone",
+			monitor:     &lb.Monitor{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.1", Settings: monitorSettings},
+			wantMonitor: &lb.Monitor{Name: cname, ServiceName: "rp-a.cisco.com", IP: "10.0.0.1", Settings: monitorSettings},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := lb.NewFake()
+			fake.Username, fake.Password = "user", "secret"
+			if test.service != nil {
+				fake.AddService(test.service)
+			}
+			if test.monitor != nil {
+				fake.AddMonitor(test.monitor)
+			}
+			server := httptest.NewServer(fake.Handler())
+			defer server.Close()
+
+			namespaces := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			namespaces.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "team",
+				Labels: map[string]string{"router": "shard-a"},
+			}})
+			c := &Controller{
+				NamespaceLister: corelisters.NewNamespaceLister(namespaces),
+				LoadBalancer:    lb.NewHTTPClient(server.URL, "user", "secret", time.Second),
+				Gocache:         gocache.New(time.Hour, time.Hour),
+				lookups:         map[string]string{"shard-a": "rp-a.cisco.com."},
+				blacklist:       Blacklist{},
+			}
+			// the RP is resolved from the cache rather than DNS
+			c.Gocache.Set(fmt.Sprintf("%s/%s", ipCacheKey, "rp-a.cisco.com."), []string{"10.0.0.1", "10.0.0.3"}, gocache.NoExpiration)
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"},
+				Spec:       routev1.RouteSpec{Host: cname},
+			}
+
+			corrections, err := c.UpdateGlobalRoute(route)
+			if err != nil {
+				t.Fatalf("UpdateGlobalRoute() = %v", err)
+			}
+			if len(corrections) != test.wantCorrections || fake.Updates() != test.wantCorrections {
+				t.Errorf("UpdateGlobalRoute() corrections = %q after %d updates, want %d", corrections, fake.Updates(), test.wantCorrections)
+			}
+			if service, _ := fake.GetService(cname); !reflect.DeepEqual(service, test.wantService) {
+				t.Errorf("service = %+v, want %+v", service, test.wantService)
+			}
+			if monitor, _ := fake.GetMonitor(cname); !reflect.DeepEqual(monitor, test.wantMonitor) {
+				t.Errorf("monitor = %+v, want %+v", monitor, test.wantMonitor)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog"
+)
+
+var (
+	// lbCorrectionsTotal counts the load balancer objects whose IP or serviceName
+	// drifted from the expected RP and was corrected
+	lbCorrectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "deploymentpodctl_lb_corrections_total",
+		Help: "Load balancer services and monitors corrected to point at the expected reverse proxy.",
+	}, []string{"object"})
+)
+
+func init() {
+	prometheus.MustRegister(lbCorrectionsTotal)
+}
+
+// serveMetrics serves the Prometheus metrics on addr until stopCh is closed.
+func serveMetrics(addr string, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("Error shutting down metrics server: %v", err)
+		}
+	}()
+
+	klog.Infof("Serving metrics on %s", addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		klog.Errorf("Error serving metrics on %s: %v", addr, err)
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// PodNodeIndex indexes pods by the node they are scheduled on
+	PodNodeIndex = "node"
+
+	// nodeActionAnnotation records what the controller did to a node, so only its
+	// own cordons and taints count against the cap
+	nodeActionAnnotation = "xxx.xxx.com/node-action"
+	nodeReasonAnnotation = "xxx.xxx.com/node-action-reason"
+	// crashLoopTaint is the taint put on nodes blamed for crash loops
+	crashLoopTaint = "xxx.xxx.com/crash-loops"
+
+	reasonNodeCrashLoops = "CrashLoopsCorrelated"
+)
+
+// PodNodeIndexFunc is the index function for PodNodeIndex. It must be added to the
+// pod informer before it is started.
+func PodNodeIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || len(pod.Spec.NodeName) == 0 {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// adverseNodeConditions are the node conditions that point at the node rather than
+// the workloads when pods crash on it
+var adverseNodeConditions = map[v1.NodeConditionType]v1.ConditionStatus{
+	v1.NodeReady:              v1.ConditionFalse,
+	v1.NodeMemoryPressure:     v1.ConditionTrue,
+	v1.NodeDiskPressure:       v1.ConditionTrue,
+	v1.NodePIDPressure:        v1.ConditionTrue,
+	v1.NodeNetworkUnavailable: v1.ConditionTrue,
+}
+
+// nodeFromCache returns the node from the node informer, or nil if it is unknown.
+func (c *Controller) nodeFromCache(name string) *v1.Node {
+	if c.NodeInformer == nil {
+		return nil
+	}
+	obj, exists, err := c.NodeInformer.GetIndexer().GetByKey(name)
+	if err != nil || !exists {
+		return nil
+	}
+	return obj.(*v1.Node)
+}
+
+// adverseConditions lists the node's conditions that indicate a problem with it.
+func adverseConditions(node *v1.Node) []string {
+	var conditions []string
+	for _, condition := range node.Status.Conditions {
+		if status, adverse := adverseNodeConditions[condition.Type]; adverse && condition.Status == status {
+			conditions = append(conditions, fmt.Sprintf("%s=%s", condition.Type, condition.Status))
+		}
+	}
+	return conditions
+}
+
+// crashingWorkloadsOnNode returns the distinct workloads with crash-looping pods on
+// the node, as '<namespace>/<name>' keys.
+func (c *Controller) crashingWorkloadsOnNode(nodeName string) []string {
+	policy := c.currentConfig().Policy
+	objs, err := c.PodInformer.GetIndexer().ByIndex(PodNodeIndex, nodeName)
+	if err != nil {
+		// without the index, fall back to scanning every pod
+		objs = c.PodInformer.GetIndexer().List()
+	}
+
+	workloads := map[string]struct{}{}
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.Spec.NodeName != nodeName || isDebugTwin(pod) {
+			continue
+		}
+		if !isCrashLooping(pod, policy.RestartThreshold, policy.Scale.Interval.Duration, c.now()) {
+			continue
+		}
+		name := workloadNameForPod(pod)
+		if len(name) == 0 {
+			name = pod.Name
+		}
+		workloads[fmt.Sprintf("%s/%s", pod.Namespace, name)] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(workloads))
+	for key := range workloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// blameNode determines if the pod's crashes are better explained by its node than
+// by its workload: several unrelated workloads crash-looping on the same node, or
+// fewer of them on a node reporting adverse conditions. It returns the node name and
+// the explanation, or an empty name if the node is not to blame.
+func (c *Controller) blameNode(pod *v1.Pod, policy config.NodePolicy) (string, string) {
+	if policy.Action == config.NodeActionDisabled || len(pod.Spec.NodeName) == 0 {
+		return "", ""
+	}
+
+	workloads := c.crashingWorkloadsOnNode(pod.Spec.NodeName)
+	threshold := int(policy.MinWorkloads)
+	var conditions []string
+	if node := c.nodeFromCache(pod.Spec.NodeName); node != nil {
+		if conditions = adverseConditions(node); len(conditions) > 0 && threshold > 2 {
+			threshold = 2
+		}
+	}
+	if len(workloads) < threshold {
+		return "", ""
+	}
+
+	reason := fmt.Sprintf("%d workloads are crash-looping on node %s (%s)", len(workloads), pod.Spec.NodeName, strings.Join(workloads, ", "))
+	if len(conditions) > 0 {
+		reason += fmt.Sprintf(", which reports %s", strings.Join(conditions, ", "))
+	}
+	return pod.Spec.NodeName, reason
+}
+
+// hasNodeAction reports whether the controller's cordon or taint is still in
+// effect on the node.
+func hasNodeAction(node *v1.Node) bool {
+	switch node.GetAnnotations()[nodeActionAnnotation] {
+	case config.NodeActionCordon:
+		return node.Spec.Unschedulable
+	case config.NodeActionTaint:
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == crashLoopTaint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// liveNodes lists the nodes from the API server rather than the informer cache, and
+// returns the named node along with how many nodes the controller currently has
+// cordoned or tainted.
+func (c *Controller) liveNodes(nodeName string) (*v1.Node, int, error) {
+	list, err := c.KubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error listing nodes: %v", err)
+	}
+	var named *v1.Node
+	acted := 0
+	for i := range list.Items {
+		node := &list.Items[i]
+		if node.Name == nodeName {
+			named = node
+		}
+		if hasNodeAction(node) {
+			acted++
+		}
+	}
+	if named == nil {
+		return nil, 0, fmt.Errorf("Error fetching node %s: not found", nodeName)
+	}
+	return named, acted, nil
+}
+
+// remediateNode cordons or taints the node blamed for crash loops, unless it is
+// already cordoned or tainted or the cap on the number of nodes is reached. The
+// workloads on it are left alone either way. Undoing it is left to an operator,
+// who uncordons the node or removes the taint.
+//
+// Workers remediate one node at a time, and count the nodes acted on from a live
+// list, so that concurrent workers, or a cache that has not seen the last update
+// yet, cannot take the controller past the cap.
+func (c *Controller) remediateNode(nodeName, reason string) error {
+	policy := c.currentConfig().Policy.Node
+	if c.NodeInformer == nil {
+		return nil
+	}
+	if node := c.nodeFromCache(nodeName); node != nil && hasNodeAction(node) {
+		return nil
+	}
+
+	c.nodeLock.Lock()
+	defer c.nodeLock.Unlock()
+	node, acted, err := c.liveNodes(nodeName)
+	if err != nil {
+		return err
+	}
+	if hasNodeAction(node) {
+		return nil
+	}
+	if node.Spec.Unschedulable && policy.Action == config.NodeActionCordon {
+		klog.Infof("Node %s is already cordoned, not acting: %s", nodeName, reason)
+		return nil
+	}
+	if acted >= int(policy.MaxNodes) {
+		message := fmt.Sprintf("Not acting, %d nodes are already cordoned or tainted, the cap is %d: %s", acted, policy.MaxNodes, reason)
+		klog.Warningf("Node %s - %s", nodeName, message)
+		c.event(node, v1.EventTypeWarning, reasonNodeCrashLoops, message)
+		return nil
+	}
+
+	copy := node.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[nodeActionAnnotation] = policy.Action
+	annotations[nodeReasonAnnotation] = reason
+	copy.SetAnnotations(annotations)
+
+	switch policy.Action {
+	case config.NodeActionCordon:
+		copy.Spec.Unschedulable = true
+	case config.NodeActionTaint:
+		now := metav1.NewTime(c.now())
+		copy.Spec.Taints = append(copy.Spec.Taints, v1.Taint{
+			Key:       crashLoopTaint,
+			Value:     "true",
+			Effect:    v1.TaintEffectNoSchedule,
+			TimeAdded: &now,
+		})
+	}
+
+	klog.Infof("Applying %s to node %s: %s", policy.Action, nodeName, reason)
+	if _, err := c.KubeClient.CoreV1().Nodes().Update(copy); err != nil {
+		return fmt.Errorf("Error applying %s to node %s: %v", policy.Action, nodeName, err)
+	}
+	c.event(node, v1.EventTypeWarning, reasonNodeCrashLoops, fmt.Sprintf("Applied %s: %s", policy.Action, reason))
+	return nil
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	"k8s.io/klog"
+)
+
+// Notification is sent whenever the controller proposes, applies or decides on
+// a remediation.
+type Notification struct {
+	Namespace  string `json:"namespace"`
+	Quarantine string `json:"quarantine"`
+	Kind       string `json:"kind"`
+	Workload   string `json:"workload"`
+	Action     string `json:"action"`
+	Phase      string `json:"phase"`
+	Message    string `json:"message"`
+}
+
+// Notifier delivers notifications to the people responsible for a workload.
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// LogNotifier writes notifications to the controller log. It is used when no
+// other notifier is configured.
+type LogNotifier struct{}
+
+// Notify logs the notification.
+func (LogNotifier) Notify(notification Notification) error {
+	klog.Infof("Notification - %s", notification.Message)
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON to a URL, such as a chat webhook.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a WebhookNotifier with a bounded request timeout.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the notification to the webhook URL.
+func (n *WebhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// NewNotifier returns the notifier for the configured webhook, defaulting to
+// logging notifications when none is set.
+func NewNotifier(notifiers config.Notifiers) Notifier {
+	if len(notifiers.WebhookURL) == 0 {
+		klog.Info("No notification webhook is configured, notifications will only be logged")
+		return LogNotifier{}
+	}
+	return NewWebhookNotifier(notifiers.WebhookURL)
+}
+
+// notify sends a notification about the Quarantine. Delivery failures are logged
+// but never fail the reconcile, since the Quarantine itself is the record.
+func (c *Controller) notify(quarantine *quarantinev1alpha1.Quarantine, message string) {
+	c.settingsLock.RLock()
+	notifier := c.Notifier
+	c.settingsLock.RUnlock()
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+
+	err := notifier.Notify(Notification{
+		Namespace:  quarantine.Namespace,
+		Quarantine: quarantine.Name,
+		Kind:       quarantine.Spec.Workload.Kind,
+		Workload:   quarantine.Spec.Workload.Name,
+		Action:     quarantine.Spec.Action,
+		Phase:      quarantine.Status.Phase,
+		Message:    message,
+	})
+	if err != nil {
+		klog.Errorf("Error sending notification for Quarantine %s/%s: %v", quarantine.Namespace, quarantine.Name, err)
+	}
+}
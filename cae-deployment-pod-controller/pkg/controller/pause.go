@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	dv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog"
+)
+
+const (
+	pausedAnnotation           = "xxx.xxx.com/paused"
+	originalTriggersAnnotation = "xxx.xxx.com/original-triggers"
+)
+
+// shouldPause reports whether the remediation action freezes rollouts.
+func shouldPause(action string) bool {
+	return action == config.ActionPause || action == config.ActionBoth
+}
+
+// shouldScale reports whether the remediation action scales replicas down.
+func shouldScale(action string) bool {
+	return action != config.ActionPause
+}
+
+// pauseDeployment sets spec.paused on the Deployment so no further rollouts happen.
+// A Deployment that was already paused by someone else is left untouched, so the
+// restore path never unpauses something the controller did not pause. The updated
+// object is returned so a subsequent step-down does not conflict.
+func (c *Controller) pauseDeployment(deployment *dv1.Deployment) (*dv1.Deployment, error) {
+	if deployment.Spec.Paused {
+		return deployment, nil
+	}
+
+	copy := deployment.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[pausedAnnotation] = "true"
+	copy.SetAnnotations(annotations)
+	copy.Spec.Paused = true
+
+	klog.Infof("Pausing rollouts for Deployment %s/%s", copy.Namespace, copy.Name)
+	updated, err := c.KubeClient.AppsV1().Deployments(copy.Namespace).Update(copy)
+	if err != nil {
+		return nil, fmt.Errorf("Error pausing Deployment %s/%s: %v", copy.Namespace, copy.Name, err)
+	}
+	return updated, nil
+}
+
+// hasRolloutTriggers reports whether the DeploymentConfig has an ImageChange or
+// ConfigChange trigger.
+func hasRolloutTriggers(deploymentconfig *dcv1.DeploymentConfig) bool {
+	for _, trigger := range deploymentconfig.Spec.Triggers {
+		if trigger.Type == dcv1.DeploymentTriggerOnImageChange || trigger.Type == dcv1.DeploymentTriggerOnConfigChange {
+			return true
+		}
+	}
+	return false
+}
+
+// pauseDeploymentConfig disables the ImageChange and ConfigChange triggers on the
+// DeploymentConfig, saving the original triggers in an annotation for restore. Any
+// other triggers are kept as they are. Triggers put back while it is paused are
+// disabled again, without overwriting the saved ones.
+func (c *Controller) pauseDeploymentConfig(deploymentconfig *dcv1.DeploymentConfig) (*dcv1.DeploymentConfig, error) {
+	_, paused := deploymentconfig.GetAnnotations()[originalTriggersAnnotation]
+	if paused && !hasRolloutTriggers(deploymentconfig) {
+		return deploymentconfig, nil
+	}
+
+	copy := deploymentconfig.DeepCopy()
+	annotations := copy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if !paused {
+		original, err := json.Marshal(deploymentconfig.Spec.Triggers)
+		if err != nil {
+			return nil, fmt.Errorf("Error saving triggers of DeploymentConfig %s/%s: %v", deploymentconfig.Namespace, deploymentconfig.Name, err)
+		}
+		annotations[originalTriggersAnnotation] = string(original)
+	}
+	copy.SetAnnotations(annotations)
+
+	triggers := dcv1.DeploymentTriggerPolicies{}
+	for _, trigger := range copy.Spec.Triggers {
+		if trigger.Type == dcv1.DeploymentTriggerOnImageChange || trigger.Type == dcv1.DeploymentTriggerOnConfigChange {
+			continue
+		}
+		triggers = append(triggers, trigger)
+	}
+	copy.Spec.Triggers = triggers
+
+	klog.Infof("Disabling triggers for DeploymentConfig %s/%s", copy.Namespace, copy.Name)
+	updated, err := c.DeploymentConfigClient.AppsV1().DeploymentConfigs(copy.Namespace).Update(copy)
+	if err != nil {
+		return nil, fmt.Errorf("Error disabling triggers of DeploymentConfig %s/%s: %v", copy.Namespace, copy.Name, err)
+	}
+	return updated, nil
+}
+
+// remediateDeploymentConfig applies the configured remediation to a DeploymentConfig
+// with crash-looping pods.
+func (c *Controller) remediateDeploymentConfig(deploymentconfig *dcv1.DeploymentConfig) error {
+	action := c.currentConfig().Policy.Action
+	if shouldPause(action) {
+		updated, err := c.pauseDeploymentConfig(deploymentconfig)
+		if err != nil {
+			return err
+		}
+		deploymentconfig = updated
+	}
+	if shouldScale(action) {
+		return c.stepDownDeploymentConfig(deploymentconfig)
+	}
+	return nil
+}
+
+// remediateDeployment applies the configured remediation to a Deployment with
+// crash-looping pods.
+func (c *Controller) remediateDeployment(deployment *dv1.Deployment) error {
+	action := c.currentConfig().Policy.Action
+	if shouldPause(action) {
+		updated, err := c.pauseDeployment(deployment)
+		if err != nil {
+			return err
+		}
+		deployment = updated
+	}
+	if shouldScale(action) {
+		return c.stepDownDeployment(deployment)
+	}
+	return nil
+}
@@ -1,142 +1,178 @@
-package controller
-
-import (
-	"fmt"
-
-	dcv1 "github.com/openshift/api/apps/v1"
-	dv1 "k8s.io/api/apps/v1"
-	v1 "k8s.io/api/core/v1"
-
-	//v1core "k8s.io/api/core/v1"
-	//resource "k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/klog"
-)
-
-const (
-	gslbCacheKey = "GSLB_CACHE_KEY"
-	ipCacheKey   = "INTERFACE_IP_CACHE_KEY"
-)
-
-var (
-	lookups   = initializeLookups()
-	blacklist = initializeBlackList()
-)
-
-// UpdateRoute is called whenever a new route is created or updated.
-// This method will also be called during every cache resync (update).
-// UpdateRoute will move routes' hostnames/cnames to the correct reverse
-// proxy (RP). If they are already on the correct RP, no-op.
-
-func getObjectType(obj interface{}) *v1.Pod {
-	switch obj_type := obj.(type) {
-	case *v1.Pod:
-		obj_type = obj.(*v1.Pod)
-		return obj_type
-	default:
-		obj_type = nil
-	}
-	return nil
-}
-
-func (c *Controller) UpdatePod(obj interface{}, isGlobalWatcher bool) error {
-	//klog.Infof("Inside Pod.go")
-
-	if obj != nil {
-		podconfig := getObjectType(obj)
-		if podconfig != nil {
-			//podconfig := obj.(*v1.Pod)
-			podconfigname := podconfig.GetObjectMeta().GetName()
-			con_status := podconfig.Status.ContainerStatuses
-			deploymentconfig_name := ""
-			deployment_name := ""
-			label_name := ""
-			key := ""
-			fmt.Println("ContainerStatus lenght: ", len(con_status))
-			if len(con_status) > 0 {
-				pod_restartcount := podconfig.Status.ContainerStatuses[0].RestartCount
-				if pod_restartcount > 1 {
-					key_namespace := podconfig.GetNamespace()
-					pod_annotations := podconfig.GetObjectMeta().GetAnnotations()
-					pod_labels := podconfig.GetObjectMeta().GetLabels()
-
-					for k := range pod_annotations {
-						//fmt.Printf("key[%s] value[%s]\n", k, pod_annotations[k])
-						if k == "openshift.io/deployment-config.name" {
-							deploymentconfig_name = pod_annotations[k]
-							key = fmt.Sprintf("%s%s%s", key_namespace, "/", deploymentconfig_name)
-						}
-						if k == "openshift.io/deployment.name" {
-							deployment_name = pod_annotations[k]
-							key = fmt.Sprintf("%s%s%s", key_namespace, "/", deployment_name)
-						}
-					}
-
-					if deploymentconfig_name == "" && deployment_name == "" {
-						for k := range pod_labels {
-							//fmt.Printf("key[%s] value[%s]\n", k, pod_annotations[k])
-							if k == "name" {
-								label_name = pod_labels[k]
-								key = fmt.Sprintf("%s%s%s", key_namespace, "/", label_name)
-							}
-						}
-
-					}
-					klog.Infof("Key - %s", key)
-					if key != "" {
-						klog.Infof("-->PodName - %s, PodNamespace - %s, PodRestartCount - %v, PodDeploymentConfigName - %s, ", podconfigname, key_namespace, pod_restartcount, deploymentconfig_name)
-						if key_namespace == "test-bh-alln-7nov" {
-							klog.Infof("PodNamespace - %s, ConfigName - %s, ", key_namespace, deploymentconfig_name)
-
-							//key_deploymentconfig := fmt.Sprintf("%s%s%s", key_namespace, "/", deploymentconfig_name)
-							obj_deploymentconfig, dc_exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
-							obj_deployment, d_exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
-							klog.Infof("DeploymentConfig? - %v , Deployment? - %v", dc_exists, d_exists)
-							if dc_exists {
-								deploymentconfig := obj_deploymentconfig.(*dcv1.DeploymentConfig)
-								deploymentconfigname := deploymentconfig.GetObjectMeta().GetName()
-								copy := deploymentconfig.DeepCopy()
-								copy.Status.Replicas = 0
-								copy.Spec.Replicas = 0
-
-								klog.Infof("Deploymentconfig Key Name - %s, DeploymentConfigName - %s", key, deploymentconfigname)
-								if err == nil {
-								}
-								klog.Infof("UpdatingDeploymentConfig")
-								klog.Infof("Deploymentconfig Key Name - %s, DeploymentConfigName - %s", key, deploymentconfigname)
-								klog.Infof("deploymentconfig.Namespace: %s", deploymentconfig.Namespace)
-
-								c.DeploymentConfigClient.AppsV1().DeploymentConfigs(deploymentconfig.Namespace).Update(copy)
-							} else if d_exists {
-								deployment := obj_deployment.(*dv1.Deployment)
-								deploymentname := deployment.GetObjectMeta().GetName()
-								replica := int32(0)
-								var replicacount *int32 = &replica
-								copy := deployment.DeepCopy()
-								copy.Spec.Replicas = replicacount
-								copy.Status.Replicas = 0
-
-								klog.Infof("Deployment Key Name - %s, DeploymentConfigName - %s", key, deploymentname)
-
-								if err == nil {
-								}
-								klog.Infof("UpdatingDeployment")
-								klog.Infof("Deployment Key Name - %s, DeploymentConfigName - %s", key, deploymentname)
-								klog.Infof("deployment.Namespace: %s", deployment.Namespace)
-
-								c.KubeClient.AppsV1().Deployments(deployment.Namespace).Update(copy)
-							}
-
-						}
-					}
-				}
-			}
-		}
-	}
-	return nil
-
-}
-
-// UpdateGlobalRoute fetches the service and monitor netscaler conifgurations for a given
-// reverse proxy, and makes sure that their IP's correspond to expected IP's (whatever IP
-// corresponds to the expected RP, fetched from AM). Will ONLY update the applicable IPs
-// and serviceName, meaning all other configuration parameters will remain the same.
+package controller
+
+import (
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//v1core "k8s.io/api/core/v1"
+	//resource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+const (
+	gslbCacheKey = "GSLB_CACHE_KEY"
+	ipCacheKey   = "INTERFACE_IP_CACHE_KEY"
+
+	deploymentConfigNameAnnotation = "openshift.io/deployment-config.name"
+	deploymentNameAnnotation       = "openshift.io/deployment.name"
+)
+
+var (
+	lookups   = initializeLookups()
+	blacklist = initializeBlackList()
+)
+
+func getObjectType(obj interface{}) *v1.Pod {
+	switch obj_type := obj.(type) {
+	case *v1.Pod:
+		obj_type = obj.(*v1.Pod)
+		return obj_type
+	default:
+		obj_type = nil
+	}
+	return nil
+}
+
+// workloadNameForPod returns the name of the workload the pod belongs to, taken from
+// the OpenShift deployment annotations, the 'name' label or the controlling owner.
+func workloadNameForPod(pod *v1.Pod) string {
+	annotations := pod.GetAnnotations()
+	if name := annotations[deploymentConfigNameAnnotation]; len(name) > 0 {
+		return name
+	}
+	if name := annotations[deploymentNameAnnotation]; len(name) > 0 {
+		return name
+	}
+	if name := pod.GetLabels()["name"]; len(name) > 0 {
+		return name
+	}
+	// DaemonSet and Job pods carry none of the above, fall back to the owner
+	if owner := metav1.GetControllerOf(pod); owner != nil && (owner.Kind == kindDaemonSet || owner.Kind == kindJob) {
+		return owner.Name
+	}
+	return ""
+}
+
+// workloadKindsForPod returns the kinds the workload of the pod can be: the kind of
+// its controller when the pod tells, otherwise both Deployment and DeploymentConfig,
+// which share the 'name' label convention.
+func workloadKindsForPod(pod *v1.Pod) []string {
+	annotations := pod.GetAnnotations()
+	if len(annotations[deploymentConfigNameAnnotation]) > 0 || len(annotations[deploymentNameAnnotation]) > 0 {
+		return []string{kindDeploymentConfig}
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		switch owner.Kind {
+		case kindDaemonSet, kindJob:
+			return []string{owner.Kind}
+		case "ReplicaSet":
+			return []string{kindDeployment}
+		case "ReplicationController":
+			return []string{kindDeploymentConfig}
+		}
+	}
+	if len(pod.GetLabels()[podTemplateHashLabel]) > 0 {
+		return []string{kindDeployment}
+	}
+	return []string{kindDeployment, kindDeploymentConfig}
+}
+
+// isCrashLooping determines if any container in the pod has exceeded the restart
+// threshold and is still failing, either waiting in CrashLoopBackOff or having
+// terminated within the last window.
+func isCrashLooping(pod *v1.Pod, threshold int32, window time.Duration, now time.Time) bool {
+	return crashLoopingContainer(pod, threshold, window, now) != nil
+}
+
+// crashLoopingContainer returns the status of the first crash-looping container of
+// the pod, or nil if there is none.
+func crashLoopingContainer(pod *v1.Pod, threshold int32, window time.Duration, now time.Time) *v1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if containerCrashLooping(pod.Status.ContainerStatuses[i], threshold, window, now) {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// containerCrashLooping is isCrashLooping for a single container.
+func containerCrashLooping(status v1.ContainerStatus, threshold int32, window time.Duration, now time.Time) bool {
+	if status.RestartCount <= threshold {
+		return false
+	}
+	if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+		return true
+	}
+	last := status.LastTerminationState.Terminated
+	return last != nil && now.Sub(last.FinishedAt.Time) < window
+}
+
+// podsForWorkload returns every pod in the informer cache that belongs to the
+// workload of the kind and name, using the pod owner index when the informer has one.
+func (c *Controller) podsForWorkload(kind, namespace, name string) []*v1.Pod {
+	if pods, indexed := c.podsByOwnerIndex(kind, namespace, name); indexed {
+		return pods
+	}
+
+	var pods []*v1.Pod
+	for _, obj := range c.PodInformer.GetIndexer().List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.Namespace != namespace || isDebugTwin(pod) {
+			continue
+		}
+		if workloadNameForPod(pod) == name && config.Contains(workloadKindsForPod(pod), kind) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+func (c *Controller) UpdatePod(obj interface{}) error {
+	pod := getObjectType(obj)
+	if pod == nil {
+		return nil
+	}
+
+	decision, err := c.Decide(pod)
+	if err != nil {
+		return err
+	}
+	// keep the workload's aggregated state current, whether or not we act
+	c.enqueueWorkload(decision.Kind, pod.Namespace, decision.Name)
+	if len(decision.BlockedImage) > 0 {
+		c.warnBlockedImage(pod, decision)
+	}
+	if len(decision.Node) > 0 {
+		return c.remediateNode(decision.Node, decision.NodeReason)
+	}
+	if !decision.Act {
+		if len(decision.Kind) > 0 {
+			klog.Infof("Not acting on pod %s - %s", decision.Pod, decision.Reasons[len(decision.Reasons)-1])
+		}
+		return nil
+	}
+	klog.Infof("-->PodName - %s, %s %s, Action - %s", decision.Pod, decision.Kind, decision.Name, decision.Action)
+	// the pod is requeued if the blocks cannot be saved, rather than acting on
+	// blocks that would be lost
+	if err := c.blockImages(decision, pod); err != nil {
+		return err
+	}
+
+	mode := c.currentConfig().Policy.DebugTwin.Mode
+	if mode == config.DebugTwinBefore || mode == config.DebugTwinInstead {
+		if err := c.createDebugTwin(pod); err != nil {
+			if mode == config.DebugTwinInstead {
+				return err
+			}
+			klog.Errorf("%v", err)
+		}
+		if mode == config.DebugTwinInstead {
+			return nil
+		}
+	}
+
+	return c.quarantineWorkload(decision, pod)
+}
@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const reasonRestoreFailed = "RestoreFailed"
+
+var (
+	// originalStateAnnotations are the workload annotations the remediations save
+	// their original settings under, copied into the Quarantine's spec.
+	originalStateAnnotations = []string{
+		originalReplicasAnnotation,
+		originalTriggersAnnotation,
+		pausedAnnotation,
+		originalUpdateStrategyAnnotation,
+		originalParallelismAnnotation,
+		suspendedAnnotation,
+	}
+)
+
+// quarantineFromUnstructured converts an object from the dynamic client or informer.
+func quarantineFromUnstructured(obj *unstructured.Unstructured) (*quarantinev1alpha1.Quarantine, error) {
+	quarantine := &quarantinev1alpha1.Quarantine{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, quarantine); err != nil {
+		return nil, fmt.Errorf("Error converting Quarantine %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return quarantine, nil
+}
+
+// quarantineToUnstructured converts a Quarantine for use with the dynamic client.
+func quarantineToUnstructured(quarantine *quarantinev1alpha1.Quarantine) (*unstructured.Unstructured, error) {
+	quarantine.APIVersion = quarantinev1alpha1.SchemeGroupVersion.String()
+	quarantine.Kind = quarantinev1alpha1.Kind
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(quarantine)
+	if err != nil {
+		return nil, fmt.Errorf("Error converting Quarantine %s/%s: %v", quarantine.Namespace, quarantine.Name, err)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// openQuarantine returns the Pending, Active or Rejected Quarantine for the workload
+// from the informer cache, or nil if there is none. A Rejected Quarantine keeps the
+// controller from proposing the same action again until it is deleted.
+func (c *Controller) openQuarantine(kind, namespace, name string) (*quarantinev1alpha1.Quarantine, error) {
+	objs, err := c.QuarantineInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing Quarantines in namespace %s from cache: %v", namespace, err)
+	}
+
+	for _, obj := range objs {
+		quarantine, err := quarantineFromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, err
+		}
+		if quarantine.Spec.Workload.Kind == kind && quarantine.Spec.Workload.Name == name &&
+			quarantine.Status.Phase != quarantinev1alpha1.PhaseReleased && quarantine.DeletionTimestamp == nil {
+			return quarantine, nil
+		}
+	}
+	return nil, nil
+}
+
+// activeQuarantines counts the Pending and Active Quarantines across all namespaces
+// in the informer cache, for the max active quarantines guardrail.
+func (c *Controller) activeQuarantines() (int, error) {
+	count := 0
+	for _, obj := range c.QuarantineInformer.GetIndexer().List() {
+		quarantine, err := quarantineFromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return 0, err
+		}
+		phase := quarantine.Status.Phase
+		if (phase == quarantinev1alpha1.PhasePending || phase == quarantinev1alpha1.PhaseActive) && quarantine.DeletionTimestamp == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// workloadAnnotations fetches the current annotations of the workload from the API,
+// since the informer cache may not have seen the remediation yet.
+func (c *Controller) workloadAnnotations(kind, namespace, name string) (map[string]string, error) {
+	var (
+		obj metav1.Object
+		err error
+	)
+	switch kind {
+	case kindDeploymentConfig:
+		obj, err = c.DeploymentConfigClient.AppsV1().DeploymentConfigs(namespace).Get(name, metav1.GetOptions{})
+	case kindDeployment:
+		obj, err = c.KubeClient.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	case kindDaemonSet:
+		obj, err = c.KubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	case kindJob:
+		obj, err = c.KubeClient.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+	case kindCronJob:
+		obj, err = c.KubeClient.BatchV1beta1().CronJobs(namespace).Get(name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("Unsupported workload kind %s for %s/%s", kind, namespace, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %s %s/%s: %v", kind, namespace, name, err)
+	}
+	return obj.GetAnnotations(), nil
+}
+
+// originalState copies the settings the remediation saved on the workload.
+func (c *Controller) originalState(kind, namespace, name string) (map[string]string, error) {
+	annotations, err := c.workloadAnnotations(kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	originalState := map[string]string{}
+	for _, key := range originalStateAnnotations {
+		if value, exists := annotations[key]; exists {
+			originalState[key] = value
+		}
+	}
+	return originalState, nil
+}
+
+// quarantineName returns the name of the Quarantine of the workload. It is the same
+// for every incident, so that workers racing on the pods of one workload, or acting
+// before the informer has seen the other's Quarantine, cannot create two of them.
+func quarantineName(kind, name string) string {
+	return fmt.Sprintf("%s-%s", strings.ToLower(kind), name)
+}
+
+// createQuarantine creates a Quarantine for the workload in the given phase. Active
+// Quarantines record a remediation that was just applied, Pending ones propose it.
+// It returns nil if the Quarantine already exists, created by another worker.
+func (c *Controller) createQuarantine(kind, namespace, name, reason, phase string) (*quarantinev1alpha1.Quarantine, error) {
+	quarantine := &quarantinev1alpha1.Quarantine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       quarantineName(kind, name),
+			Namespace:  namespace,
+			Finalizers: []string{quarantinev1alpha1.Finalizer},
+		},
+		Spec: quarantinev1alpha1.QuarantineSpec{
+			Workload: quarantinev1alpha1.WorkloadReference{Kind: kind, Name: name},
+			Reason:   reason,
+			Action:   actionFor(kind, c.currentConfig().Policy.Action),
+		},
+	}
+	if phase == quarantinev1alpha1.PhaseActive {
+		originalState, err := c.originalState(kind, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		quarantine.Spec.OriginalState = originalState
+	}
+
+	obj, err := quarantineToUnstructured(quarantine)
+	if err != nil {
+		return nil, err
+	}
+	created, err := c.DynamicClient.Resource(quarantinev1alpha1.Resource).Namespace(namespace).Create(obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		klog.Infof("Quarantine %s/%s already exists", namespace, quarantine.Name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Quarantine for %s %s/%s: %v", kind, namespace, name, err)
+	}
+	klog.Infof("Created %s Quarantine %s/%s for %s %s", phase, created.GetNamespace(), created.GetName(), kind, name)
+
+	// status is a subresource, so it has to be set after the object exists
+	quarantine, err = quarantineFromUnstructured(created)
+	if err != nil {
+		return nil, err
+	}
+	quarantine.Status.Phase = phase
+	if phase == quarantinev1alpha1.PhaseActive {
+		markActive(quarantine)
+	}
+	return quarantine, c.updateQuarantineStatus(quarantine)
+}
+
+// clearReleasedQuarantine makes room for a new Quarantine of the workload, deleting
+// the Released one of an earlier incident, which has the same name. It returns a
+// retryable error until the Released Quarantine is gone, so that the workload is not
+// remediated before its new Quarantine can be created.
+func (c *Controller) clearReleasedQuarantine(kind, namespace, name string) error {
+	key := fmt.Sprintf("%s/%s", namespace, quarantineName(kind, name))
+	obj, exists, err := c.QuarantineInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		return nil
+	}
+	quarantine, err := quarantineFromUnstructured(obj.(*unstructured.Unstructured))
+	if err != nil {
+		return err
+	}
+	if quarantine.DeletionTimestamp == nil && quarantine.Status.Phase != quarantinev1alpha1.PhaseReleased {
+		return nil
+	}
+
+	if quarantine.DeletionTimestamp == nil {
+		err := c.DynamicClient.Resource(quarantinev1alpha1.Resource).Namespace(namespace).Delete(quarantine.Name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Error deleting Released Quarantine %s: %v", key, err)
+		}
+		klog.Infof("Deleted Released Quarantine %s to quarantine %s %s again", key, kind, name)
+	}
+	return fmt.Errorf("Waiting for Quarantine %s of an earlier incident to be deleted", key)
+}
+
+// markActive sets the status of a Quarantine whose remediation was just applied.
+func markActive(quarantine *quarantinev1alpha1.Quarantine) {
+	now := metav1.Now()
+	quarantine.Status.Phase = quarantinev1alpha1.PhaseActive
+	quarantine.Status.QuarantinedAt = &now
+	quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+		Type:               quarantinev1alpha1.ConditionQuarantined,
+		Status:             v1.ConditionTrue,
+		Reason:             quarantine.Spec.Action,
+		Message:            quarantine.Spec.Reason,
+		LastTransitionTime: now,
+	})
+}
+
+// updateQuarantineStatus writes the Quarantine's status subresource.
+func (c *Controller) updateQuarantineStatus(quarantine *quarantinev1alpha1.Quarantine) error {
+	obj, err := quarantineToUnstructured(quarantine)
+	if err != nil {
+		return err
+	}
+	if _, err := c.DynamicClient.Resource(quarantinev1alpha1.Resource).Namespace(quarantine.Namespace).UpdateStatus(obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Error updating status of Quarantine %s/%s: %v", quarantine.Namespace, quarantine.Name, err)
+	}
+	return nil
+}
+
+// updateQuarantine writes the Quarantine's metadata and spec.
+func (c *Controller) updateQuarantine(quarantine *quarantinev1alpha1.Quarantine) (*quarantinev1alpha1.Quarantine, error) {
+	obj, err := quarantineToUnstructured(quarantine)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := c.DynamicClient.Resource(quarantinev1alpha1.Resource).Namespace(quarantine.Namespace).Update(obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error updating Quarantine %s/%s: %v", quarantine.Namespace, quarantine.Name, err)
+	}
+	return quarantineFromUnstructured(updated)
+}
+
+// hasFinalizer reports whether the Quarantine still carries the controller's finalizer.
+func hasFinalizer(quarantine *quarantinev1alpha1.Quarantine) bool {
+	for _, finalizer := range quarantine.Finalizers {
+		if finalizer == quarantinev1alpha1.Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseQuarantine restores the workload and moves the Quarantine to Released.
+func (c *Controller) releaseQuarantine(quarantine *quarantinev1alpha1.Quarantine) error {
+	workload := quarantine.Spec.Workload
+	if err := c.RestoreWorkload(workload.Kind, quarantine.Namespace, workload.Name); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	quarantine.Status.Phase = quarantinev1alpha1.PhaseReleased
+	quarantine.Status.ReleasedAt = &now
+	quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+		Type:               quarantinev1alpha1.ConditionQuarantined,
+		Status:             v1.ConditionFalse,
+		Reason:             "Released",
+		LastTransitionTime: now,
+	})
+	quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+		Type:               quarantinev1alpha1.ConditionRestored,
+		Status:             v1.ConditionTrue,
+		Reason:             "Released",
+		Message:            fmt.Sprintf("%s %s restored at %s", workload.Kind, workload.Name, now.UTC().Format(time.RFC3339)),
+		LastTransitionTime: now,
+	})
+	klog.Infof("Released Quarantine %s/%s, restored %s %s", quarantine.Namespace, quarantine.Name, workload.Kind, workload.Name)
+	return c.updateQuarantineStatus(quarantine)
+}
+
+// recoverPhase sets the phase of a Quarantine created without one. Only Active
+// Quarantines are created with the original state of their workload, Pending ones
+// only propose the remediation.
+func (c *Controller) recoverPhase(quarantine *quarantinev1alpha1.Quarantine) error {
+	if len(quarantine.Spec.OriginalState) > 0 {
+		markActive(quarantine)
+	} else {
+		quarantine.Status.Phase = quarantinev1alpha1.PhasePending
+	}
+	klog.Warningf("Quarantine %s/%s has no phase, setting it to %s", quarantine.Namespace, quarantine.Name, quarantine.Status.Phase)
+	return c.updateQuarantineStatus(quarantine)
+}
+
+// restoreOnDelete restores the workload of an Active Quarantine being deleted. A
+// workload that is already gone counts as restored, and a restore that can never
+// succeed is reported with an Event on the Quarantine, so that neither keeps the
+// Quarantine, or the namespace it is in, from being deleted.
+func (c *Controller) restoreOnDelete(obj *unstructured.Unstructured, quarantine *quarantinev1alpha1.Quarantine) error {
+	workload := quarantine.Spec.Workload
+	err := c.RestoreWorkload(workload.Kind, quarantine.Namespace, workload.Name)
+	if apierrors.IsNotFound(err) {
+		klog.Infof("%s %s/%s of deleted Quarantine %s is gone, nothing to restore", workload.Kind, quarantine.Namespace, workload.Name, quarantine.Name)
+		return nil
+	}
+	if _, ok := err.(*errortypes.NonRetryableError); ok {
+		message := fmt.Sprintf("Could not restore %s %s, removing the finalizer anyway: %v", workload.Kind, workload.Name, err)
+		klog.Errorf("Quarantine %s/%s: %s", quarantine.Namespace, quarantine.Name, message)
+		c.event(obj, v1.EventTypeWarning, reasonRestoreFailed, message)
+		return nil
+	}
+	return err
+}
+
+// processQuarantine reconciles a Quarantine. Pending Quarantines wait for approval.
+// Setting spec.release on an Active one restores the workload and keeps the object;
+// deleting an Active one restores the workload and then removes the finalizer. A
+// Quarantine without a phase, whose status could not be written after creating it,
+// gets the phase it was created for.
+func (c *Controller) processQuarantine(key string) error {
+	obj, exists, err := c.QuarantineInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		return nil
+	}
+
+	quarantine, err := quarantineFromUnstructured(obj.(*unstructured.Unstructured))
+	if err != nil {
+		return err
+	}
+
+	if quarantine.DeletionTimestamp != nil {
+		if !hasFinalizer(quarantine) {
+			return nil
+		}
+		if quarantine.Status.Phase == quarantinev1alpha1.PhaseActive {
+			if err := c.restoreOnDelete(obj.(*unstructured.Unstructured), quarantine); err != nil {
+				return err
+			}
+		}
+
+		finalizers := []string{}
+		for _, finalizer := range quarantine.Finalizers {
+			if finalizer != quarantinev1alpha1.Finalizer {
+				finalizers = append(finalizers, finalizer)
+			}
+		}
+		quarantine.Finalizers = finalizers
+		_, err := c.updateQuarantine(quarantine)
+		return err
+	}
+
+	switch quarantine.Status.Phase {
+	case "":
+		return c.recoverPhase(quarantine)
+	case quarantinev1alpha1.PhasePending:
+		return c.reconcilePending(key, quarantine)
+	case quarantinev1alpha1.PhaseActive:
+		if quarantine.Spec.Release {
+			return c.releaseQuarantine(quarantine)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	dv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	// PodOwnerIndex indexes pods by the '<kind>/<namespace>/<name>' of their workload
+	PodOwnerIndex = "workload"
+
+	podTemplateHashLabel         = "pod-template-hash"
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	controllerRevisionHashLabel  = "controller-revision-hash"
+)
+
+// PodOwnerIndexFunc is the index function for PodOwnerIndex. It must be added to
+// the pod informer before it is started. Pods whose workload kind cannot be told
+// from the pod are indexed under every kind it can be.
+func PodOwnerIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || isDebugTwin(pod) {
+		return nil, nil
+	}
+	name := workloadNameForPod(pod)
+	if len(name) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	for _, kind := range workloadKindsForPod(pod) {
+		keys = append(keys, podOwnerKey(kind, pod.Namespace, name))
+	}
+	return keys, nil
+}
+
+// podOwnerKey returns the PodOwnerIndex key of the workload.
+func podOwnerKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// podRevision returns the revision of the workload the pod was created from: the
+// ReplicationController of a DeploymentConfig, the pod template hash of a Deployment
+// or the controller revision of a DaemonSet. Job pods have no revision.
+func podRevision(pod *v1.Pod) string {
+	labels := pod.GetLabels()
+	if revision := labels[podTemplateHashLabel]; len(revision) > 0 {
+		return revision
+	}
+	if _, dc := pod.GetAnnotations()[deploymentConfigNameAnnotation]; dc {
+		return pod.GetAnnotations()[deploymentNameAnnotation]
+	}
+	return labels[controllerRevisionHashLabel]
+}
+
+// revisionHealth counts the pods of one revision of a workload.
+type revisionHealth struct {
+	Revision     string
+	Replicas     int32
+	CrashLooping int32
+}
+
+func (h revisionHealth) percent() int32 {
+	if h.Replicas == 0 {
+		return 0
+	}
+	return h.CrashLooping * 100 / h.Replicas
+}
+
+// currentRevision determines the revision new pods of the workload are created from.
+// For DeploymentConfigs it is the latest ReplicationController, for Deployments the
+// newest ReplicaSet, and for everything else, or if those cannot be found, the
+// revision of the most recently created pod.
+func (c *Controller) currentRevision(kind, namespace, name string, pods []*v1.Pod) string {
+	switch kind {
+	case kindDeploymentConfig:
+		obj, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(fmt.Sprintf("%s/%s", namespace, name))
+		if err == nil && exists {
+			return fmt.Sprintf("%s-%d", name, obj.(*dcv1.DeploymentConfig).Status.LatestVersion)
+		}
+	case kindDeployment:
+		revision, err := c.deploymentRevision(namespace, name)
+		if err != nil {
+			klog.Warningf("Falling back to the newest pod for the revision of Deployment %s/%s: %v", namespace, name, err)
+		}
+		if len(revision) > 0 {
+			return revision
+		}
+	}
+
+	var newest *v1.Pod
+	for _, pod := range pods {
+		if newest == nil || newest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			newest = pod
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return podRevision(newest)
+}
+
+// deploymentRevision returns the pod template hash of the Deployment's ReplicaSet
+// with the highest revision, which is the one the Deployment creates new pods from,
+// even after a rollback to an older template. It is empty if the Deployment has
+// no ReplicaSet yet, or the controller does not watch ReplicaSets.
+func (c *Controller) deploymentRevision(namespace, name string) (string, error) {
+	if c.ReplicaSetInformer == nil {
+		return "", nil
+	}
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	obj, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching Deployment with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		return "", nil
+	}
+	deployment := obj.(*dv1.Deployment)
+	objs, err := c.ReplicaSetInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return "", fmt.Errorf("Error listing ReplicaSets in namespace %s from cache: %v", namespace, err)
+	}
+
+	var newest *dv1.ReplicaSet
+	var newestRevision int64
+	for _, obj := range objs {
+		replicaset, ok := obj.(*dv1.ReplicaSet)
+		if !ok || !metav1.IsControlledBy(replicaset, deployment) {
+			continue
+		}
+		revision, _ := strconv.ParseInt(replicaset.GetAnnotations()[deploymentRevisionAnnotation], 10, 64)
+		if newest == nil || revision > newestRevision ||
+			(revision == newestRevision && newest.CreationTimestamp.Before(&replicaset.CreationTimestamp)) {
+			newest, newestRevision = replicaset, revision
+		}
+	}
+	if newest == nil {
+		return "", nil
+	}
+	return newest.GetLabels()[podTemplateHashLabel], nil
+}
+
+// revisionHealths counts the replicas and crash-looping pods of every revision of
+// the workload, returning the current revision first.
+func (c *Controller) revisionHealths(kind, namespace, name string) []revisionHealth {
+	policy := c.currentConfig().Policy
+	pods := c.podsForWorkload(kind, namespace, name)
+	current := c.currentRevision(kind, namespace, name, pods)
+
+	byRevision := map[string]*revisionHealth{current: {Revision: current}}
+	healths := []*revisionHealth{byRevision[current]}
+	for _, pod := range pods {
+		revision := podRevision(pod)
+		health, exists := byRevision[revision]
+		if !exists {
+			health = &revisionHealth{Revision: revision}
+			byRevision[revision] = health
+			healths = append(healths, health)
+		}
+		health.Replicas++
+		if isCrashLooping(pod, policy.RestartThreshold, policy.Scale.Interval.Duration, c.now()) {
+			health.CrashLooping++
+		}
+	}
+
+	result := make([]revisionHealth, 0, len(healths))
+	for _, health := range healths {
+		result = append(result, *health)
+	}
+	return result
+}
+
+// meetsQuorum reports whether enough pods of the revision are crash-looping for
+// the controller to act: at least minReplicas of them, or at least percent of them.
+// A zero setting disables that half of the rule.
+func meetsQuorum(health revisionHealth, quorum config.QuorumPolicy) bool {
+	if quorum.MinReplicas > 0 && health.CrashLooping >= quorum.MinReplicas {
+		return true
+	}
+	return quorum.Percent > 0 && health.CrashLooping > 0 && health.percent() >= quorum.Percent
+}
+
+// checkQuorum adds the quorum evaluation to the decision and reports whether it
+// was met. Only pods of the current revision count, pods left over from other
+// revisions are reported separately.
+func (c *Controller) checkQuorum(decision *Decision, namespace string) bool {
+	quorum := c.currentConfig().Policy.Quorum
+	healths := c.revisionHealths(decision.Kind, namespace, decision.Name)
+	current := healths[0]
+	for _, other := range healths[1:] {
+		if other.CrashLooping > 0 {
+			decision.because("%d of %d pods of other revision %q are crash-looping, not counted", other.CrashLooping, other.Replicas, other.Revision)
+		}
+	}
+
+	met := meetsQuorum(current, quorum)
+	verb := "meets"
+	if !met {
+		verb = "does not meet"
+	}
+	decision.because("%d of %d pods of current revision %q are crash-looping (%d%%), which %s the quorum of %d replicas or %d%%",
+		current.CrashLooping, current.Replicas, current.Revision, current.percent(), verb, quorum.MinReplicas, quorum.Percent)
+	return met
+}
+
+// podsByOwnerIndex returns the pods indexed under the workload key, or false if
+// the pod informer has no owner index.
+func (c *Controller) podsByOwnerIndex(kind, namespace, name string) ([]*v1.Pod, bool) {
+	objs, err := c.PodInformer.GetIndexer().ByIndex(PodOwnerIndex, podOwnerKey(kind, namespace, name))
+	if err != nil {
+		klog.V(4).Infof("Pod owner index unavailable, listing all pods: %v", err)
+		return nil, false
+	}
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, true
+}
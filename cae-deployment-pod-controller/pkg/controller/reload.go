@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/klog"
+)
+
+const (
+	// the ConfigMaps the controller reloads its settings from, in its own namespace
+	configConfigMap    = "deployment-controller-config"
+	shard2vipConfigMap = "shard2vip-config"
+	blacklistConfigMap = "blacklist-config"
+	// blockedImagesConfigMap is also written by the controller, see images.go
+
+	configKey    = "config.yaml"
+	shard2vipKey = "shard2vip.properties"
+	blacklistKey = "blacklist.properties"
+
+	reasonConfigReloaded = "ConfigReloaded"
+	reasonConfigInvalid  = "ConfigInvalid"
+)
+
+// IsWatchedConfigMap reports whether the ConfigMap is one the controller reloads
+// its settings from, so event handlers can skip every other ConfigMap.
+func IsWatchedConfigMap(name string) bool {
+	return name == configConfigMap || name == shard2vipConfigMap || name == blacklistConfigMap || name == blockedImagesConfigMap
+}
+
+// currentLookups returns the router shard to RP lookups in effect, which come from
+// the shard2vip ConfigMap once it has been loaded and from the environment before.
+func (c *Controller) currentLookups() map[string]string {
+	c.settingsLock.RLock()
+	defer c.settingsLock.RUnlock()
+	if c.lookups == nil {
+		return lookups
+	}
+	return c.lookups
+}
+
+// currentBlacklist returns the blacklist rules in effect, which come from the
+// blacklist ConfigMap once it has been loaded and from the environment before.
+func (c *Controller) currentBlacklist() Blacklist {
+	c.settingsLock.RLock()
+	defer c.settingsLock.RUnlock()
+	if c.blacklist == nil {
+		return blacklist
+	}
+	return c.blacklist
+}
+
+// parseConfig parses, applies overrides to and validates a configuration file
+// using the ParseConfig hook, falling back to the file alone without it.
+func (c *Controller) parseConfig(data []byte) (*config.Config, error) {
+	if c.ParseConfig != nil {
+		return c.ParseConfig(data)
+	}
+	parsed, err := config.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := parsed.Validate(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// restartRequired lists the settings that changed but only apply on restart,
+// because the informers and workers are already running.
+func restartRequired(old, new *config.Config) []string {
+	var fields []string
+	if old.Workers != new.Workers {
+		fields = append(fields, "workers")
+	}
+	if old.ResyncPeriod != new.ResyncPeriod {
+		fields = append(fields, "resyncPeriod")
+	}
+	if old.GlobalResyncPeriod != new.GlobalResyncPeriod {
+		fields = append(fields, "globalResyncPeriod")
+	}
+	if old.Webhook != new.Webhook {
+		fields = append(fields, "webhook")
+	}
+	if old.AddressManagement != new.AddressManagement {
+		fields = append(fields, "addressManagement")
+	}
+	if old.GSLB.URL != new.GSLB.URL || old.GSLB.Timeout != new.GSLB.Timeout {
+		fields = append(fields, "gslb")
+	}
+	if old.LoadBalancer != new.LoadBalancer {
+		fields = append(fields, "loadBalancer")
+	}
+	if old.Metrics != new.Metrics {
+		fields = append(fields, "metrics")
+	}
+	return fields
+}
+
+// reloadConfig swaps in the configuration from the controller ConfigMap. The
+// notifier is rebuilt when its settings change.
+func (c *Controller) reloadConfig(configMap *v1.ConfigMap) (string, error) {
+	data, exists := configMap.Data[configKey]
+	if !exists {
+		return "", fmt.Errorf("missing key %s", configKey)
+	}
+	parsed, err := c.parseConfig([]byte(data))
+	if err != nil {
+		return "", err
+	}
+
+	old := c.currentConfig()
+	if equality.Semantic.DeepEqual(old, parsed) {
+		return "", nil
+	}
+
+	c.settingsLock.Lock()
+	c.Config = parsed
+	if old.Notifiers != parsed.Notifiers {
+		c.Notifier = NewNotifier(parsed.Notifiers)
+	}
+	c.settingsLock.Unlock()
+
+	message := fmt.Sprintf("Reloaded configuration %s", parsed.APIVersion)
+	if fields := restartRequired(old, parsed); len(fields) > 0 {
+		message += fmt.Sprintf(", changes to %s apply after a restart", strings.Join(fields, ", "))
+	}
+	return message, nil
+}
+
+// reloadLookups swaps in the router shard to RP lookups from the shard2vip ConfigMap.
+func (c *Controller) reloadLookups(configMap *v1.ConfigMap) (string, error) {
+	parsed, errs := parseLookups(configMap.Data[shard2vipKey])
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s:\n  %s", shard2vipKey, strings.Join(errs, "\n  "))
+	}
+	if equality.Semantic.DeepEqual(c.currentLookups(), parsed) {
+		return "", nil
+	}
+
+	c.settingsLock.Lock()
+	c.lookups = parsed
+	c.settingsLock.Unlock()
+	return fmt.Sprintf("Reloaded %d router shard lookups", len(parsed)), nil
+}
+
+// reloadBlacklist swaps in the blacklist rules from the blacklist ConfigMap.
+func (c *Controller) reloadBlacklist(configMap *v1.ConfigMap) (string, error) {
+	parsed, errs := parseBlackList(configMap.Data[blacklistKey])
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s:\n  %s", blacklistKey, strings.Join(errs, "\n  "))
+	}
+	if equality.Semantic.DeepEqual(c.currentBlacklist().Entries(), parsed.Entries()) {
+		return "", nil
+	}
+
+	c.settingsLock.Lock()
+	c.blacklist = parsed
+	c.settingsLock.Unlock()
+
+	expired := 0
+	for _, rule := range parsed {
+		if rule.Expired(c.now()) {
+			expired++
+		}
+	}
+	return fmt.Sprintf("Reloaded %d blacklist rules, %d of them expired", len(parsed), expired), nil
+}
+
+// processConfigMap handles keys on the ConfigMapQueue. The settings from the
+// ConfigMap are parsed and validated, and only swapped in when valid; otherwise the
+// last good settings stay in effect. Either way an Event is emitted on the ConfigMap,
+// unless nothing changed. A deleted ConfigMap also leaves the last settings in effect.
+func (c *Controller) processConfigMap(key string) error {
+	obj, exists, err := c.ConfigMapInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		klog.Warningf("ConfigMap %s was deleted, keeping the last loaded settings", key)
+		return nil
+	}
+
+	configMap := obj.(*v1.ConfigMap)
+	var message string
+	switch configMap.Name {
+	case configConfigMap:
+		message, err = c.reloadConfig(configMap)
+	case shard2vipConfigMap:
+		message, err = c.reloadLookups(configMap)
+	case blacklistConfigMap:
+		message, err = c.reloadBlacklist(configMap)
+	case blockedImagesConfigMap:
+		message, err = c.reloadBlockedImages(configMap)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		klog.Errorf("Invalid ConfigMap %s, keeping the last good settings: %v", key, err)
+		c.event(configMap, v1.EventTypeWarning, reasonConfigInvalid, fmt.Sprintf("Keeping the last good settings: %v", err))
+		return nil
+	}
+	if len(message) > 0 {
+		klog.Infof("%s from ConfigMap %s", message, key)
+		c.event(configMap, v1.EventTypeNormal, reasonConfigReloaded, message)
+	}
+	return nil
+}
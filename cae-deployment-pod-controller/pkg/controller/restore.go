@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	dv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// fetchError describes an error fetching a workload to restore. NotFound is returned
+// as is, so callers can tell with apierrors.IsNotFound that the workload, or its
+// namespace, is gone and there is nothing left to restore.
+func fetchError(kind, namespace, name string, err error) error {
+	if apierrors.IsNotFound(err) {
+		return err
+	}
+	return fmt.Errorf("Error fetching %s %s/%s: %v", kind, namespace, name, err)
+}
+
+// clearScaleAnnotations removes every annotation the step-down and restore flow uses.
+func clearScaleAnnotations(annotations map[string]string) map[string]string {
+	delete(annotations, originalReplicasAnnotation)
+	delete(annotations, lastStepDownAnnotation)
+	delete(annotations, restoreAnnotation)
+	return annotations
+}
+
+// restoreTriggers puts back the triggers saved by pauseDeploymentConfig, if any.
+func restoreTriggers(deploymentconfig *dcv1.DeploymentConfig) error {
+	annotations := deploymentconfig.GetAnnotations()
+	original, exists := annotations[originalTriggersAnnotation]
+	if !exists {
+		return nil
+	}
+
+	triggers := dcv1.DeploymentTriggerPolicies{}
+	if err := json.Unmarshal([]byte(original), &triggers); err != nil {
+		return fmt.Errorf("Error parsing %s annotation of DeploymentConfig %s/%s: %v", originalTriggersAnnotation, deploymentconfig.Namespace, deploymentconfig.Name, err)
+	}
+	deploymentconfig.Spec.Triggers = triggers
+	delete(annotations, originalTriggersAnnotation)
+	return nil
+}
+
+// restoreDeploymentConfig scales the DeploymentConfig back to its original replica
+// count, re-enables its triggers, releases its autoscalers and clears the remediation
+// bookkeeping. The autoscalers are released first, so that if that fails the
+// bookkeeping is still there for the retry.
+func (c *Controller) restoreDeploymentConfig(deploymentconfig *dcv1.DeploymentConfig) error {
+	if err := c.releaseAutoscalers(kindDeploymentConfig, deploymentconfig.Namespace, deploymentconfig.Name); err != nil {
+		return err
+	}
+
+	copy := deploymentconfig.DeepCopy()
+	if replicas, ok := originalReplicas(copy.GetAnnotations()); ok {
+		copy.Spec.Replicas = replicas
+	}
+	if err := restoreTriggers(copy); err != nil {
+		return err
+	}
+	copy.SetAnnotations(clearScaleAnnotations(copy.GetAnnotations()))
+
+	klog.Infof("Restoring DeploymentConfig %s/%s to %d replicas", copy.Namespace, copy.Name, copy.Spec.Replicas)
+	if _, err := c.DeploymentConfigClient.AppsV1().DeploymentConfigs(copy.Namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error restoring DeploymentConfig %s/%s: %v", copy.Namespace, copy.Name, err)
+	}
+	return nil
+}
+
+// restoreDeployment scales the Deployment back to its original replica count,
+// resumes rollouts if the controller paused them, releases its autoscalers and
+// clears the remediation bookkeeping. The autoscalers are released first, so that if
+// that fails the bookkeeping is still there for the retry.
+func (c *Controller) restoreDeployment(deployment *dv1.Deployment) error {
+	if err := c.releaseAutoscalers(kindDeployment, deployment.Namespace, deployment.Name); err != nil {
+		return err
+	}
+
+	copy := deployment.DeepCopy()
+	if replicas, ok := originalReplicas(copy.GetAnnotations()); ok {
+		copy.Spec.Replicas = &replicas
+	}
+	annotations := copy.GetAnnotations()
+	if _, paused := annotations[pausedAnnotation]; paused {
+		copy.Spec.Paused = false
+		delete(annotations, pausedAnnotation)
+	}
+	copy.SetAnnotations(clearScaleAnnotations(annotations))
+
+	klog.Infof("Restoring Deployment %s/%s", copy.Namespace, copy.Name)
+	if _, err := c.KubeClient.AppsV1().Deployments(copy.Namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error restoring Deployment %s/%s: %v", copy.Namespace, copy.Name, err)
+	}
+	return nil
+}
+
+// RestoreWorkload undoes every remediation the controller applied to the workload,
+// whatever its kind. It is the single entrypoint of the restore flow. A workload that
+// no longer exists is reported with a NotFound error.
+func (c *Controller) RestoreWorkload(kind, namespace, name string) error {
+	switch kind {
+	case kindDeploymentConfig:
+		deploymentconfig, err := c.DeploymentConfigClient.AppsV1().DeploymentConfigs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fetchError(kind, namespace, name, err)
+		}
+		return c.restoreDeploymentConfig(deploymentconfig)
+	case kindDeployment:
+		deployment, err := c.KubeClient.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fetchError(kind, namespace, name, err)
+		}
+		return c.restoreDeployment(deployment)
+	case kindDaemonSet:
+		return c.restoreDaemonSet(namespace, name)
+	case kindJob:
+		return c.restoreJob(namespace, name)
+	case kindCronJob:
+		return c.resumeCronJob(namespace, name)
+	}
+	return errortypes.Errorf("Unsupported workload kind %s for %s/%s", kind, namespace, name)
+}
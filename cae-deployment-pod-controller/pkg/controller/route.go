@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+
+	v1 "github.com/openshift/api/route/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/am"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const reasonAliasMoved = "AliasMoved"
+
+// processRoute reconciles a Route from the RouteQueue. Deleted routes need no
+// cleanup, their aliases are left to address management.
+func (c *Controller) processRoute(key string) error {
+	obj, exists, err := c.RouteInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		klog.V(4).Infof("Route %s was deleted", key)
+		return nil
+	}
+	return c.UpdateRoute(obj.(*v1.Route))
+}
+
+// admittedRP returns the reverse proxy serving the route, from the canonical hostname
+// of the routers that admitted it, with the trailing '.' of the lookups. It returns
+// an empty string while no router has admitted the route.
+func admittedRP(route *v1.Route) string {
+	for _, ingress := range route.Status.Ingress {
+		if len(ingress.RouterCanonicalHostname) == 0 {
+			continue
+		}
+		for _, condition := range ingress.Conditions {
+			if condition.Type == v1.RouteAdmitted && condition.Status == "True" {
+				return am.CanonicalRP(ingress.RouterCanonicalHostname)
+			}
+		}
+	}
+	return ""
+}
+
+// actualRP returns the RP the route's cname is an alias of in address management,
+// or the RP that admitted the route when address management is not configured.
+func (c *Controller) actualRP(route *v1.Route) (string, error) {
+	if c.AddressManagement == nil {
+		return admittedRP(route), nil
+	}
+	return c.AddressManagement.GetAlias(route.Spec.Host)
+}
+
+// UpdateRoute is called whenever a new route is created or updated.
+// This method will also be called during every cache resync (update).
+// UpdateRoute will move routes' hostnames/cnames to the correct reverse
+// proxy (RP). If they are already on the correct RP, no-op.
+//
+// Once the route is on the expected RP, its GSLB entry is pointed at that RP in
+// the local datacenter.
+//
+// The route's cname-phase annotation tracks the outcome: 'initializing' until the
+// cname is first given an alias, 'complete' once it is on the expected RP and
+// 'failed' when the expected RP cannot be determined, address management or the
+// GSLB fail, or the route is on another RP and there is no address management to
+// move it. A route initializing for longer than the initializing timeout fails, and
+// failed routes are retried with backoff, see annotations.go.
+func (c *Controller) UpdateRoute(route *v1.Route) error {
+	_, err := c.syncRoute(route)
+	return err
+}
+
+// syncRoute does the work of UpdateRoute, and returns the corrections it made to
+// address management and the GSLB, for the global reconcile to report.
+func (c *Controller) syncRoute(route *v1.Route) ([]string, error) {
+	cname := route.Spec.Host
+	if len(cname) == 0 || c.isBlackListed(cname, route) {
+		return nil, nil
+	}
+	state := getRouteState(route)
+	if c.waitForRetry(route, state) {
+		return nil, nil
+	}
+
+	expected, err := c.lookupRP(route)
+	if err != nil {
+		return nil, c.annotateFailed(err, route, state)
+	}
+
+	actual, err := c.actualRP(route)
+	if err != nil {
+		return nil, c.annotateFailed(err, route, state)
+	}
+	if isRouteInitializing(state.Phase, actual) {
+		return nil, c.initializingError(cname, route, state)
+	}
+
+	var corrections []string
+	if actual != expected {
+		if c.AddressManagement == nil {
+			return nil, c.annotateFailed(errortypes.Errorf("Route is on the wrong RP - cname: %s, route: %s/%s, actual: %s, expected: %s",
+				cname, route.Namespace, route.Name, actual, expected), route, state)
+		}
+		if err := c.AddressManagement.MoveAlias(cname, expected); err != nil {
+			return nil, c.annotateFailed(err, route, state)
+		}
+		message := fmt.Sprintf("Moved cname %s from RP %s to %s", cname, actual, expected)
+		klog.Infof("%s - route: %s/%s", message, route.Namespace, route.Name)
+		c.event(route, corev1.EventTypeNormal, reasonAliasMoved, message)
+		corrections = append(corrections, message)
+	}
+
+	message, err := c.ensureGSLB(route, expected)
+	if err != nil {
+		return corrections, c.annotateFailed(err, route, state)
+	}
+	if len(message) > 0 {
+		corrections = append(corrections, message)
+	}
+
+	klog.V(4).Infof("Route is on the expected RP - cname: %s, route: %s/%s, RP: %s", cname, route.Namespace, route.Name, expected)
+	return corrections, c.annotateComplete(route, state, expected)
+}
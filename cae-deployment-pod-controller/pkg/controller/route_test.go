@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routefake "github.com/openshift/client-go/route/clientset/versioned/fake"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/am"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSyncRouteMovesAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		// phase is the route's cname-phase annotation, none if empty
+		phase string
+		// router is the router label of the route's namespace
+		router string
+		// alias is the RP address management has for the cname, none if empty
+		alias    string
+		password string
+
+		wantAlias     string
+		wantMoves     int
+		wantPhase     string
+		wantErr       bool
+		wantRetryable bool
+	}{
+		{
+			name:      "alias on the wrong RP is moved",
+			phase:     complete,
+			router:    "shard-a",
+			alias:     "rp-b.cisco.com",
+			wantAlias: "rp-a.cisco.com.",
+			wantMoves: 1,
+			wantPhase: complete,
+		},
+		{
+			name:      "alias on the expected RP is left alone",
+			phase:     complete,
+			router:    "shard-a",
+			alias:     "rp-a.cisco.com",
+			wantAlias: "rp-a.cisco.com.",
+			wantPhase: complete,
+		},
+		{
+			name:          "new route without an alias waits for the initial one",
+			router:        "shard-a",
+			wantPhase:     initializing,
+			wantErr:       true,
+			wantRetryable: true,
+		},
+		{
+			name:      "complete route whose alias went missing gets it back",
+			phase:     complete,
+			router:    "shard-a",
+			wantAlias: "rp-a.cisco.com.",
+			wantMoves: 1,
+			wantPhase: complete,
+		},
+		{
+			name:      "unknown router shard fails without moving",
+			phase:     complete,
+			router:    "shard-unknown",
+			alias:     "rp-b.cisco.com",
+			wantAlias: "rp-b.cisco.com.",
+			wantPhase: failed,
+			wantErr:   true,
+		},
+		{
+			name:      "rejected credentials fail without moving",
+			phase:     complete,
+			router:    "shard-a",
+			alias:     "rp-b.cisco.com",
+			password:  "wrong",
+			wantAlias: "rp-b.cisco.com.",
+			wantPhase: failed,
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			const cname = "app.cisco.com"
+			aliases := map[string]string{}
+			if len(test.alias) > 0 {
+				aliases[cname] = test.alias
+			}
+			fake := am.NewFake(aliases)
+			fake.Username, fake.Password = "user", "secret"
+			server := httptest.NewServer(fake.Handler())
+			defer server.Close()
+			password := "secret"
+			if len(test.password) > 0 {
+				password = test.password
+			}
+
+			namespaces := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			namespaces.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "team",
+				Labels: map[string]string{"router": test.router},
+			}})
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team", CreationTimestamp: metav1.Now()},
+				Spec:       routev1.RouteSpec{Host: cname},
+			}
+			if len(test.phase) > 0 {
+				route.Annotations = map[string]string{
+					cnamePhase:      test.phase,
+					cnamePhaseSince: time.Now().UTC().Format(time.RFC3339),
+				}
+			}
+			routeClient := routefake.NewSimpleClientset(route)
+
+			c := &Controller{
+				RouteClient:       routeClient,
+				NamespaceLister:   corelisters.NewNamespaceLister(namespaces),
+				AddressManagement: am.NewHTTPClient(server.URL, "user", password, time.Second),
+				lookups:           map[string]string{"shard-a": "rp-a.cisco.com."},
+				blacklist:         Blacklist{},
+			}
+
+			_, err := c.syncRoute(route)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("syncRoute() = %v, want error %t", err, test.wantErr)
+			}
+			if err != nil {
+				if _, nonRetryable := err.(*errortypes.NonRetryableError); nonRetryable == test.wantRetryable {
+					t.Errorf("syncRoute() = %v, want retryable %t", err, test.wantRetryable)
+				}
+			}
+
+			if alias, _ := fake.GetAlias(cname); alias != test.wantAlias {
+				t.Errorf("alias of %s = %q, want %q", cname, alias, test.wantAlias)
+			}
+			if moves := fake.Moves(); moves != test.wantMoves {
+				t.Errorf("alias moved %d times, want %d", moves, test.wantMoves)
+			}
+			updated, err := routeClient.RouteV1().Routes("team").Get("app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Error fetching route: %v", err)
+			}
+			if phase := updated.Annotations[cnamePhase]; phase != test.wantPhase {
+				t.Errorf("cname-phase = %q, want %q", phase, test.wantPhase)
+			}
+		})
+	}
+}
+
+func TestWaitForRetry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		phase      string
+		nextRetry  time.Time
+		generation string
+		want       bool
+	}{
+		{name: "complete route is not waiting", phase: complete, want: false},
+		{name: "failed route waits for its retry", phase: failed, nextRetry: now.Add(time.Minute), generation: "2", want: true},
+		{name: "failed route is retried when due", phase: failed, nextRetry: now.Add(-time.Minute), generation: "2", want: false},
+		{name: "changed route is retried at once", phase: failed, nextRetry: now.Add(time.Minute), generation: "1", want: false},
+		{name: "route failed without a generation waits", phase: failed, nextRetry: now.Add(time.Minute), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{
+				Name:       "app",
+				Namespace:  "team",
+				Generation: 2,
+				Annotations: map[string]string{
+					cnamePhase:          test.phase,
+					cnamePhaseNextRetry: test.nextRetry.Format(time.RFC3339),
+				},
+			}}
+			if len(test.generation) > 0 {
+				route.Annotations[cnamePhaseGeneration] = test.generation
+			}
+			c := &Controller{Clock: clock.NewFakeClock(now)}
+
+			if waiting := c.waitForRetry(route, getRouteState(route)); waiting != test.want {
+				t.Errorf("waitForRetry() = %t, want %t", waiting, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	routershardv1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/routershard/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+)
+
+// routerShardFromUnstructured converts an object from the dynamic client or informer.
+func routerShardFromUnstructured(obj *unstructured.Unstructured) (*routershardv1alpha1.RouterShard, error) {
+	routerShard := &routershardv1alpha1.RouterShard{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, routerShard); err != nil {
+		return nil, fmt.Errorf("Error converting RouterShard %s: %v", obj.GetName(), err)
+	}
+	return routerShard, nil
+}
+
+// routerShardToUnstructured converts a RouterShard for use with the dynamic client.
+func routerShardToUnstructured(routerShard *routershardv1alpha1.RouterShard) (*unstructured.Unstructured, error) {
+	routerShard.APIVersion = routershardv1alpha1.SchemeGroupVersion.String()
+	routerShard.Kind = routershardv1alpha1.Kind
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(routerShard)
+	if err != nil {
+		return nil, fmt.Errorf("Error converting RouterShard %s: %v", routerShard.Name, err)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// validateRouterShard returns everything wrong with the spec. The shard and
+// datacenter must be label values, since the shard is matched against the
+// projects' 'router' label, and the RP a hostname, with or without the trailing '.'.
+func validateRouterShard(spec *routershardv1alpha1.RouterShardSpec) []string {
+	var errs []string
+	if len(spec.Shard) == 0 {
+		errs = append(errs, "spec.shard is required")
+	}
+	for _, msg := range validation.IsValidLabelValue(spec.Shard) {
+		errs = append(errs, fmt.Sprintf("spec.shard %q is invalid: %s", spec.Shard, msg))
+	}
+	if rp := strings.TrimSuffix(spec.RP, "."); len(rp) == 0 {
+		errs = append(errs, "spec.rp is required")
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(rp) {
+			errs = append(errs, fmt.Sprintf("spec.rp %q is invalid: %s", spec.RP, msg))
+		}
+	}
+	for _, msg := range validation.IsValidLabelValue(spec.Datacenter) {
+		errs = append(errs, fmt.Sprintf("spec.datacenter %q is invalid: %s", spec.Datacenter, msg))
+	}
+	if spec.Weight < 0 {
+		errs = append(errs, fmt.Sprintf("spec.weight %d is invalid: must be 0 or more", spec.Weight))
+	}
+	return errs
+}
+
+// routerShardConditions are the Valid and Active conditions of a RouterShard.
+type routerShardConditions [2]routershardv1alpha1.RouterShardCondition
+
+func newRouterShardConditions(valid v1.ConditionStatus, validReason, validMessage string, active v1.ConditionStatus, activeReason, activeMessage string) routerShardConditions {
+	return routerShardConditions{
+		{Type: routershardv1alpha1.ConditionValid, Status: valid, Reason: validReason, Message: validMessage},
+		{Type: routershardv1alpha1.ConditionActive, Status: active, Reason: activeReason, Message: activeMessage},
+	}
+}
+
+// selectRouterShards builds the router shard to RP lookups from the RouterShards,
+// along with the conditions of each RouterShard, by name. Of the valid and enabled
+// RouterShards for the local datacenter, or for every datacenter, the one with the
+// highest weight is used for its shard, preferring one for the local datacenter and
+// then the first by name. When the local datacenter is not configured, the
+// datacenters are not checked.
+func selectRouterShards(routerShards []*routershardv1alpha1.RouterShard, datacenter string) (map[string]string, map[string]routerShardConditions) {
+	lookups := map[string]string{}
+	conditions := map[string]routerShardConditions{}
+	candidates := map[string][]*routershardv1alpha1.RouterShard{}
+	for _, routerShard := range routerShards {
+		spec := &routerShard.Spec
+		switch errs := validateRouterShard(spec); {
+		case len(errs) > 0:
+			conditions[routerShard.Name] = newRouterShardConditions(v1.ConditionFalse, "InvalidSpec", strings.Join(errs, "; "),
+				v1.ConditionFalse, "InvalidSpec", "Invalid RouterShards are not used for lookups")
+		case !spec.IsEnabled():
+			conditions[routerShard.Name] = newRouterShardConditions(v1.ConditionTrue, "Validated", "",
+				v1.ConditionFalse, "Disabled", "The RouterShard is disabled")
+		case len(datacenter) > 0 && len(spec.Datacenter) > 0 && spec.Datacenter != datacenter:
+			conditions[routerShard.Name] = newRouterShardConditions(v1.ConditionTrue, "Validated", "",
+				v1.ConditionFalse, "OtherDatacenter", fmt.Sprintf("The RP is in datacenter %s, not the local datacenter %s", spec.Datacenter, datacenter))
+		default:
+			candidates[spec.Shard] = append(candidates[spec.Shard], routerShard)
+		}
+	}
+
+	for shard, routerShards := range candidates {
+		sort.Slice(routerShards, func(i, j int) bool {
+			a, b := routerShards[i], routerShards[j]
+			if a.Spec.Weight != b.Spec.Weight {
+				return a.Spec.Weight > b.Spec.Weight
+			}
+			if local := len(a.Spec.Datacenter) > 0; local != (len(b.Spec.Datacenter) > 0) {
+				return local
+			}
+			return a.Name < b.Name
+		})
+
+		selected := routerShards[0]
+		rp := selected.Spec.RP
+		// AM response has '.' at end of each RP, example: "my-infra-vip.cisco.com."
+		if !strings.HasSuffix(rp, ".") {
+			rp += "."
+		}
+		lookups[shard] = rp
+		conditions[selected.Name] = newRouterShardConditions(v1.ConditionTrue, "Validated", "",
+			v1.ConditionTrue, "Selected", fmt.Sprintf("Routes on shard %s are expected on RP %s", shard, rp))
+		for _, routerShard := range routerShards[1:] {
+			conditions[routerShard.Name] = newRouterShardConditions(v1.ConditionTrue, "Validated", "",
+				v1.ConditionFalse, "Superseded", fmt.Sprintf("RouterShard %s is used for shard %s", selected.Name, shard))
+		}
+	}
+	return lookups, conditions
+}
+
+// currentRouterShardLookups returns the router shard to RP lookups from the
+// RouterShards, which take precedence over the shard2vip lookups.
+func (c *Controller) currentRouterShardLookups() map[string]string {
+	c.settingsLock.RLock()
+	defer c.settingsLock.RUnlock()
+	return c.routerShardLookups
+}
+
+// lookupShard returns the RP of the router shard, from its RouterShard or else the
+// shard2vip lookups, or empty if neither has it.
+func (c *Controller) lookupShard(shard string) string {
+	if rp, exists := c.currentRouterShardLookups()[shard]; exists {
+		return rp
+	}
+	return c.currentLookups()[shard]
+}
+
+// processRouterShard handles keys on the RouterShardQueue. A change to any
+// RouterShard may change which one is used for its shard, so the lookups are rebuilt
+// from every RouterShard in the cache whatever the key, and the status of each one
+// whose conditions changed is updated. A single worker runs it, so the lookups are
+// never swapped out of order.
+func (c *Controller) processRouterShard(key string) error {
+	var routerShards []*routershardv1alpha1.RouterShard
+	for _, obj := range c.RouterShardInformer.GetIndexer().List() {
+		routerShard, err := routerShardFromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return err
+		}
+		if routerShard.DeletionTimestamp == nil {
+			routerShards = append(routerShards, routerShard)
+		}
+	}
+
+	lookups, conditions := selectRouterShards(routerShards, c.currentConfig().GSLB.Datacenter)
+	if !equality.Semantic.DeepEqual(c.currentRouterShardLookups(), lookups) {
+		c.settingsLock.Lock()
+		c.routerShardLookups = lookups
+		c.settingsLock.Unlock()
+		klog.Infof("Loaded %d router shard lookups from RouterShards: %+v", len(lookups), lookups)
+	}
+
+	var errs []string
+	for _, routerShard := range routerShards {
+		status := &routershardv1alpha1.RouterShardStatus{
+			ObservedGeneration: routerShard.Generation,
+			Conditions:         append([]routershardv1alpha1.RouterShardCondition(nil), routerShard.Status.Conditions...),
+		}
+		now := metav1.Now()
+		for _, condition := range conditions[routerShard.Name] {
+			condition.LastTransitionTime = now
+			status.SetCondition(condition)
+		}
+		if equality.Semantic.DeepEqual(&routerShard.Status, status) {
+			continue
+		}
+
+		if valid := conditions[routerShard.Name][0]; valid.Status == v1.ConditionFalse {
+			klog.Warningf("RouterShard %s is invalid and not used for lookups: %s", routerShard.Name, valid.Message)
+		}
+		routerShard.Status = *status
+		if err := c.updateRouterShardStatus(routerShard); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// updateRouterShardStatus writes the RouterShard's status subresource.
+func (c *Controller) updateRouterShardStatus(routerShard *routershardv1alpha1.RouterShard) error {
+	obj, err := routerShardToUnstructured(routerShard)
+	if err != nil {
+		return err
+	}
+	if _, err := c.DynamicClient.Resource(routershardv1alpha1.Resource).UpdateStatus(obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Error updating status of RouterShard %s: %v", routerShard.Name, err)
+	}
+	return nil
+}
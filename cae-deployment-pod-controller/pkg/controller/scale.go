@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	dv1 "k8s.io/api/apps/v1"
+	"k8s.io/klog"
+)
+
+const (
+	originalReplicasAnnotation = "xxx.xxx.com/original-replicas"
+	lastStepDownAnnotation     = "xxx.xxx.com/last-step-down"
+	restoreAnnotation          = "xxx.xxx.com/restore"
+)
+
+// nextReplicas returns the replica count for the next step down from current,
+// according to the scale policy. It never goes below the floor or above current,
+// so a result equal to current means there is nothing left to do.
+func nextReplicas(current int32, scale config.ScalePolicy) int32 {
+	var next int32
+	switch scale.Strategy {
+	case config.ScaleHalve:
+		next = current / 2
+	case config.ScaleStep:
+		next = current - scale.Step
+	default:
+		next = 0
+	}
+
+	if next < scale.Floor {
+		next = scale.Floor
+	}
+	if next > current {
+		next = current
+	}
+	return next
+}
+
+// stepDownWait returns how long until the next step down is allowed, based on the
+// last-step-down annotation. Zero means a step can be taken now.
+func stepDownWait(annotations map[string]string, now time.Time, interval time.Duration) time.Duration {
+	last, err := time.Parse(time.RFC3339, annotations[lastStepDownAnnotation])
+	if err != nil {
+		return 0
+	}
+	if wait := last.Add(interval).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// isSteppingDown reports whether a step-down is in progress for the workload.
+func isSteppingDown(annotations map[string]string) bool {
+	_, exists := annotations[lastStepDownAnnotation]
+	return exists
+}
+
+// markStepDown records the original replica count (only on the first step, so the
+// restore path always sees the count from before the controller intervened) and the
+// time of this step.
+func markStepDown(annotations map[string]string, current int32, now time.Time) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, exists := annotations[originalReplicasAnnotation]; !exists {
+		annotations[originalReplicasAnnotation] = strconv.Itoa(int(current))
+	}
+	annotations[lastStepDownAnnotation] = now.UTC().Format(time.RFC3339)
+	return annotations
+}
+
+// stepDownDeploymentConfig takes a single step down for the DeploymentConfig and
+// requeues it on the DeploymentConfigQueue so the next step is considered once the
+// interval elapses.
+func (c *Controller) stepDownDeploymentConfig(deploymentconfig *dcv1.DeploymentConfig) error {
+	key := fmt.Sprintf("%s/%s", deploymentconfig.Namespace, deploymentconfig.Name)
+	scale := c.currentConfig().Policy.Scale
+	now := c.now()
+
+	if wait := stepDownWait(deploymentconfig.GetAnnotations(), now, scale.Interval.Duration); wait > 0 {
+		c.DeploymentConfigQueue.AddAfter(key, wait)
+		return nil
+	}
+
+	current := deploymentconfig.Spec.Replicas
+	next := nextReplicas(current, scale)
+	if next == current {
+		klog.Infof("DeploymentConfig %s is at the scale floor of %d replicas, not stepping down", key, current)
+		return nil
+	}
+
+	copy := deploymentconfig.DeepCopy()
+	copy.SetAnnotations(markStepDown(copy.GetAnnotations(), current, now))
+	copy.Spec.Replicas = next
+
+	if err := c.holdAutoscalers(kindDeploymentConfig, copy.Namespace, copy.Name, next); err != nil {
+		return err
+	}
+	klog.Infof("Stepping down DeploymentConfig %s from %d to %d replicas", key, current, next)
+	if _, err := c.DeploymentConfigClient.AppsV1().DeploymentConfigs(copy.Namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error scaling DeploymentConfig %s: %v", key, err)
+	}
+
+	if next > scale.Floor {
+		c.DeploymentConfigQueue.AddAfter(key, scale.Interval.Duration)
+	}
+	return nil
+}
+
+// stepDownDeployment takes a single step down for the Deployment and requeues it on
+// the DeploymentQueue so the next step is considered once the interval elapses.
+func (c *Controller) stepDownDeployment(deployment *dv1.Deployment) error {
+	key := fmt.Sprintf("%s/%s", deployment.Namespace, deployment.Name)
+	scale := c.currentConfig().Policy.Scale
+	now := c.now()
+
+	if wait := stepDownWait(deployment.GetAnnotations(), now, scale.Interval.Duration); wait > 0 {
+		c.DeploymentQueue.AddAfter(key, wait)
+		return nil
+	}
+
+	// a nil replica count defaults to 1
+	current := int32(1)
+	if deployment.Spec.Replicas != nil {
+		current = *deployment.Spec.Replicas
+	}
+	next := nextReplicas(current, scale)
+	if next == current {
+		klog.Infof("Deployment %s is at the scale floor of %d replicas, not stepping down", key, current)
+		return nil
+	}
+
+	copy := deployment.DeepCopy()
+	copy.SetAnnotations(markStepDown(copy.GetAnnotations(), current, now))
+	copy.Spec.Replicas = &next
+
+	if err := c.holdAutoscalers(kindDeployment, copy.Namespace, copy.Name, next); err != nil {
+		return err
+	}
+	klog.Infof("Stepping down Deployment %s from %d to %d replicas", key, current, next)
+	if _, err := c.KubeClient.AppsV1().Deployments(copy.Namespace).Update(copy); err != nil {
+		return fmt.Errorf("Error scaling Deployment %s: %v", key, err)
+	}
+
+	if next > scale.Floor {
+		c.DeploymentQueue.AddAfter(key, scale.Interval.Duration)
+	}
+	return nil
+}
+
+// stopStepDown removes the last-step-down annotation, ending the step-down while
+// keeping the original replica count for the restore path.
+func stopStepDown(annotations map[string]string) map[string]string {
+	delete(annotations, lastStepDownAnnotation)
+	return annotations
+}
+
+// originalReplicas parses the replica count saved before the first step down.
+func originalReplicas(annotations map[string]string) (int32, bool) {
+	v, exists := annotations[originalReplicasAnnotation]
+	if !exists {
+		return 0, false
+	}
+	replicas, err := strconv.Atoi(v)
+	if err != nil {
+		klog.Errorf("Invalid %s annotation value %q: %v", originalReplicasAnnotation, v, err)
+		return 0, false
+	}
+	return int32(replicas), true
+}
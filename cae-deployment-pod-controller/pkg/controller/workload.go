@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	dcv1 "github.com/openshift/api/apps/v1"
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	dv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	kindDeploymentConfig = "DeploymentConfig"
+	kindDeployment       = "Deployment"
+)
+
+// workloadHealth is the aggregated state of every pod of a workload.
+type workloadHealth struct {
+	Replicas     int32
+	Ready        int32
+	CrashLooping int32
+}
+
+func (h workloadHealth) String() string {
+	return fmt.Sprintf("%d of %d replicas crash-looping, %d ready", h.CrashLooping, h.Replicas, h.Ready)
+}
+
+// isPodReady reports whether the pod's Ready condition is true.
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// workloadHealth aggregates the pods of the named workload from the informer cache.
+// A pod counts as crash-looping if it is still failing within the last step-down
+// interval.
+func (c *Controller) workloadHealth(kind, namespace, name string) workloadHealth {
+	policy := c.currentConfig().Policy
+	health := workloadHealth{}
+	for _, pod := range c.podsForWorkload(kind, namespace, name) {
+		health.Replicas++
+		if isPodReady(pod) {
+			health.Ready++
+		}
+		if isCrashLooping(pod, policy.RestartThreshold, policy.Scale.Interval.Duration, c.now()) {
+			health.CrashLooping++
+		}
+	}
+	return health
+}
+
+// enqueueWorkload queues the workload for its reconciler, so the aggregated state
+// follows the pod events.
+func (c *Controller) enqueueWorkload(kind, namespace, name string) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	switch kind {
+	case kindDeploymentConfig:
+		c.DeploymentConfigQueue.Add(key)
+	case kindDeployment:
+		c.DeploymentQueue.Add(key)
+	}
+}
+
+// syncQuarantine keeps the open Quarantine of the workload in step with it. The pod
+// counts are recorded on every change, and when the workload is deleted (health is
+// nil) the Quarantine is released, since there is nothing left to restore or approve.
+func (c *Controller) syncQuarantine(kind, namespace, name string, health *workloadHealth) error {
+	quarantine, err := c.openQuarantine(kind, namespace, name)
+	if err != nil || quarantine == nil {
+		return err
+	}
+
+	if health == nil {
+		now := metav1.Now()
+		quarantine.Status.Phase = quarantinev1alpha1.PhaseReleased
+		quarantine.Status.ReleasedAt = &now
+		quarantine.Status.SetCondition(quarantinev1alpha1.QuarantineCondition{
+			Type:               quarantinev1alpha1.ConditionRestored,
+			Status:             v1.ConditionFalse,
+			Reason:             "WorkloadDeleted",
+			Message:            fmt.Sprintf("%s %s was deleted at %s", kind, name, now.UTC().Format(time.RFC3339)),
+			LastTransitionTime: now,
+		})
+		klog.Infof("Released Quarantine %s/%s, %s %s was deleted", quarantine.Namespace, quarantine.Name, kind, name)
+		return c.updateQuarantineStatus(quarantine)
+	}
+
+	if quarantine.Status.Replicas == health.Replicas && quarantine.Status.CrashLooping == health.CrashLooping {
+		return nil
+	}
+	quarantine.Status.Replicas = health.Replicas
+	quarantine.Status.CrashLooping = health.CrashLooping
+	return c.updateQuarantineStatus(quarantine)
+}
+
+// restoreFromAnnotation restores the workload when its restore annotation is set.
+// An Active Quarantine is released along with it, so the record stays consistent
+// and further crashes do not continue the remediation.
+func (c *Controller) restoreFromAnnotation(kind, namespace, name string, restore func() error) error {
+	quarantine, err := c.openQuarantine(kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	if quarantine != nil && quarantine.Status.Phase == quarantinev1alpha1.PhaseActive {
+		return c.releaseQuarantine(quarantine)
+	}
+	return restore()
+}
+
+// processDeploymentConfig reconciles a DeploymentConfig from the DeploymentConfigQueue.
+// It aggregates the state of its pods, restores it when the restore annotation is
+// set, continues an in-progress step-down for as long as its pods keep crash-looping,
+// and keeps its Quarantine up to date.
+func (c *Controller) processDeploymentConfig(key string) error {
+	obj, exists, err := c.DeploymentConfigInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return err
+		}
+		return c.syncQuarantine(kindDeploymentConfig, namespace, name, nil)
+	}
+
+	deploymentconfig := obj.(*dcv1.DeploymentConfig)
+	annotations := deploymentconfig.GetAnnotations()
+	if annotations[restoreAnnotation] == "true" {
+		return c.restoreFromAnnotation(kindDeploymentConfig, deploymentconfig.Namespace, deploymentconfig.Name, func() error {
+			return c.restoreDeploymentConfig(deploymentconfig)
+		})
+	}
+
+	health := c.workloadHealth(kindDeploymentConfig, deploymentconfig.Namespace, deploymentconfig.Name)
+	if err := c.syncQuarantine(kindDeploymentConfig, deploymentconfig.Namespace, deploymentconfig.Name, &health); err != nil {
+		return err
+	}
+	if !isSteppingDown(annotations) {
+		return nil
+	}
+
+	if health.CrashLooping == 0 {
+		copy := deploymentconfig.DeepCopy()
+		copy.SetAnnotations(stopStepDown(copy.GetAnnotations()))
+		klog.Infof("Crash loops stopped for DeploymentConfig %s (%s), ending step-down at %d replicas", key, health, copy.Spec.Replicas)
+		if _, err := c.DeploymentConfigClient.AppsV1().DeploymentConfigs(copy.Namespace).Update(copy); err != nil {
+			return fmt.Errorf("Error updating DeploymentConfig %s: %v", key, err)
+		}
+		return nil
+	}
+	klog.Infof("DeploymentConfig %s is stepping down, %s", key, health)
+	return c.stepDownDeploymentConfig(deploymentconfig)
+}
+
+// processDeployment reconciles a Deployment from the DeploymentQueue. It aggregates
+// the state of its pods, restores it when the restore annotation is set, continues
+// an in-progress step-down for as long as its pods keep crash-looping, and keeps its
+// Quarantine up to date.
+func (c *Controller) processDeployment(key string) error {
+	obj, exists, err := c.DeploymentInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error fetching object with key %s from cache: %v", key, err)
+	}
+	if !exists {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return err
+		}
+		return c.syncQuarantine(kindDeployment, namespace, name, nil)
+	}
+
+	deployment := obj.(*dv1.Deployment)
+	annotations := deployment.GetAnnotations()
+	if annotations[restoreAnnotation] == "true" {
+		return c.restoreFromAnnotation(kindDeployment, deployment.Namespace, deployment.Name, func() error {
+			return c.restoreDeployment(deployment)
+		})
+	}
+
+	health := c.workloadHealth(kindDeployment, deployment.Namespace, deployment.Name)
+	if err := c.syncQuarantine(kindDeployment, deployment.Namespace, deployment.Name, &health); err != nil {
+		return err
+	}
+	if !isSteppingDown(annotations) {
+		return nil
+	}
+
+	if health.CrashLooping == 0 {
+		copy := deployment.DeepCopy()
+		copy.SetAnnotations(stopStepDown(copy.GetAnnotations()))
+		klog.Infof("Crash loops stopped for Deployment %s (%s), ending step-down", key, health)
+		if _, err := c.KubeClient.AppsV1().Deployments(copy.Namespace).Update(copy); err != nil {
+			return fmt.Errorf("Error updating Deployment %s: %v", key, err)
+		}
+		return nil
+	}
+	klog.Infof("Deployment %s is stepping down, %s", key, health)
+	return c.stepDownDeployment(deployment)
+}
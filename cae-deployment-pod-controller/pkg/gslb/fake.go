@@ -0,0 +1,94 @@
+package gslb
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory GSLB. It implements Client directly, and its Handler serves
+// the same REST API as the real one, so HTTPClient can be run against it with
+// httptest.NewServer.
+type Fake struct {
+	// Username and Password, when set, make the Handler answer 401 to requests
+	// without those basic auth credentials
+	Username string
+	Password string
+
+	lock    sync.Mutex
+	entries map[string]*Entry
+	lists   int
+}
+
+// NewFake returns a fake holding the entries.
+func NewFake(entries ...Entry) *Fake {
+	f := &Fake{entries: map[string]*Entry{}}
+	for i := range entries {
+		f.entries[entries[i].Hostname] = entries[i].DeepCopy()
+	}
+	return f
+}
+
+// ListEntries returns every entry, sorted by hostname.
+func (f *Fake) ListEntries() ([]Entry, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.lists++
+	entries := make([]Entry, 0, len(f.entries))
+	for _, entry := range f.entries {
+		entries = append(entries, *entry.DeepCopy())
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hostname < entries[j].Hostname })
+	return entries, nil
+}
+
+// SetMember points the hostname's entry at the VIP in the datacenter.
+func (f *Fake) SetMember(hostname, datacenter, vip string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	entry, exists := f.entries[hostname]
+	if !exists {
+		entry = &Entry{Hostname: hostname, Members: map[string]string{}}
+		f.entries[hostname] = entry
+	}
+	entry.Members[datacenter] = CanonicalVIP(vip)
+	return nil
+}
+
+// Lists returns how many times the entries were listed, to check caching.
+func (f *Fake) Lists() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.lists
+}
+
+// Handler serves the entries over the GSLB REST API.
+func (f *Fake) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(f.Username) > 0 || len(f.Password) > 0 {
+			if username, password, ok := r.BasicAuth(); !ok || username != f.Username || password != f.Password {
+				http.Error(w, "invalid credentials", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		switch parts := strings.Split(strings.TrimPrefix(r.URL.Path, entriesPath), "/"); {
+		case r.Method == http.MethodGet && len(parts) == 1 && len(parts[0]) == 0:
+			entries, _ := f.ListEntries()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+		case r.Method == http.MethodPut && len(parts) == 4 && len(parts[0]) == 0 && parts[2] == "members":
+			m := member{}
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil || len(m.VIP) == 0 || m.Datacenter != parts[3] {
+				http.Error(w, "invalid member", http.StatusBadRequest)
+				return
+			}
+			f.SetMember(parts[1], m.Datacenter, m.VIP)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+// Package gslb is the client of the global server load balancer (GSLB), which
+// resolves route hosts to the VIP of a healthy datacenter, so routes fail over
+// between datacenters.
+package gslb
+
+import "strings"
+
+// Client lists GSLB entries and sets the members of their datacenters.
+type Client interface {
+	// ListEntries returns every entry the GSLB holds
+	ListEntries() ([]Entry, error)
+	// SetMember points the hostname's entry at the VIP in the datacenter, creating
+	// the entry if needed and leaving the other datacenters alone
+	SetMember(hostname, datacenter, vip string) error
+}
+
+// Entry is the GSLB entry of a hostname, with the VIP serving it in each
+// datacenter.
+type Entry struct {
+	Hostname string            `json:"hostname"`
+	Members  map[string]string `json:"members"`
+}
+
+// DeepCopy returns a copy of the entry.
+func (e *Entry) DeepCopy() *Entry {
+	copy := &Entry{Hostname: e.Hostname, Members: make(map[string]string, len(e.Members))}
+	for datacenter, vip := range e.Members {
+		copy.Members[datacenter] = vip
+	}
+	return copy
+}
+
+// CanonicalVIP returns the VIP without the trailing '.' of the address management
+// and lookup RPs, the form the GSLB uses.
+func CanonicalVIP(vip string) string {
+	return strings.TrimSuffix(vip, ".")
+}
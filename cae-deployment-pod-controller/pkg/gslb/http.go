@@ -0,0 +1,65 @@
+package gslb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/httpapi"
+)
+
+// entriesPath is where the API serves the entries, by hostname
+const entriesPath = "/entries"
+
+// member is the body setting the member of a datacenter
+type member struct {
+	Datacenter string `json:"datacenter"`
+	VIP        string `json:"vip"`
+}
+
+// HTTPClient talks to the GSLB REST API with basic auth.
+type HTTPClient struct {
+	*httpapi.Client
+}
+
+// NewHTTPClient returns a client of the GSLB REST API at url, logging in with basic
+// auth. Every request fails after the timeout, including listing all the entries.
+func NewHTTPClient(url, username, password string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{httpapi.NewClient("GSLB", url, timeout, httpapi.BasicAuth(username, password))}
+}
+
+// ListEntries returns every entry.
+func (c *HTTPClient) ListEntries() ([]Entry, error) {
+	resp, err := c.Do(http.MethodGet, entriesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := httpapi.CheckStatus(resp, "Error listing entries in GSLB"); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("Error decoding GSLB entries: %v", err)
+	}
+	return entries, nil
+}
+
+// SetMember points the hostname's entry at the VIP in the datacenter.
+func (c *HTTPClient) SetMember(hostname, datacenter, vip string) error {
+	body, err := json.Marshal(member{Datacenter: datacenter, VIP: CanonicalVIP(vip)})
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/%s/members/%s", entriesPath, url.PathEscape(hostname), url.PathEscape(datacenter))
+	resp, err := c.Do(http.MethodPut, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return httpapi.CheckStatus(resp, "Error setting the %s member of %s in GSLB", datacenter, hostname)
+}
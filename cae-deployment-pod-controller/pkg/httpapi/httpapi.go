@@ -0,0 +1,85 @@
+// Package httpapi is the HTTP plumbing shared by the clients of the external APIs
+// the controller drives: address management, the GSLB and the load balancers. It
+// sends authenticated JSON requests and classifies failures as retryable or not,
+// leaving the resources and their encoding to each client.
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+)
+
+// Client sends authenticated JSON requests to an API.
+type Client struct {
+	// Name names the API in errors, e.g. "address management"
+	Name string
+	URL  string
+	// Authenticate adds the credentials to every request
+	Authenticate func(req *http.Request)
+	HTTP         *http.Client
+}
+
+// NewClient returns a client of the API at url, bounding every request to the
+// timeout.
+func NewClient(name, url string, timeout time.Duration, authenticate func(req *http.Request)) *Client {
+	return &Client{
+		Name:         name,
+		URL:          strings.TrimSuffix(url, "/"),
+		Authenticate: authenticate,
+		HTTP:         &http.Client{Timeout: timeout},
+	}
+}
+
+// BasicAuth authenticates requests with basic auth.
+func BasicAuth(username, password string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+// Do sends an authenticated request to the path, with a JSON body if body is not
+// nil. Transport errors, including timeouts, are retryable.
+func (c *Client) Do(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return nil, errortypes.Errorf("Error building %s request %s %s: %v", c.Name, method, path, err)
+	}
+	if c.Authenticate != nil {
+		c.Authenticate(req)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error calling %s %s %s: %v", c.Name, method, path, err)
+	}
+	return resp, nil
+}
+
+// CheckStatus classifies an unsuccessful response, describing the failure with the
+// format and args followed by the status and the start of the response body.
+// Throttling and server errors are retryable; any other client error, such as bad
+// credentials or a rejected request, will not go away by retrying and is
+// non-retryable.
+func CheckStatus(resp *http.Response, format string, args ...interface{}) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	failure := fmt.Sprintf("%s: %s %s", fmt.Sprintf(format, args...), resp.Status, strings.TrimSpace(string(message)))
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return errors.New(failure)
+	}
+	return errortypes.New(failure)
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/errortypes"
+)
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantErr   bool
+		retryable bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusBadRequest, wantErr: true},
+		{status: http.StatusUnauthorized, wantErr: true},
+		{status: http.StatusForbidden, wantErr: true},
+		{status: http.StatusNotFound, wantErr: true},
+		{status: http.StatusConflict, wantErr: true},
+		{status: http.StatusRequestTimeout, wantErr: true, retryable: true},
+		{status: http.StatusTooManyRequests, wantErr: true, retryable: true},
+		{status: http.StatusInternalServerError, wantErr: true, retryable: true},
+		{status: http.StatusBadGateway, wantErr: true, retryable: true},
+		{status: http.StatusServiceUnavailable, wantErr: true, retryable: true},
+	}
+	for _, test := range tests {
+		resp := &http.Response{
+			StatusCode: test.status,
+			Status:     http.StatusText(test.status),
+			Body:       ioutil.NopCloser(strings.NewReader("details\n")),
+		}
+		err := CheckStatus(resp, "Error moving alias of cname %s", "app.cisco.com")
+		if (err != nil) != test.wantErr {
+			t.Errorf("status %d: got error %v, want error %t", test.status, err, test.wantErr)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+		if _, nonRetryable := err.(*errortypes.NonRetryableError); nonRetryable == test.retryable {
+			t.Errorf("status %d: got retryable %t, want %t: %v", test.status, !nonRetryable, test.retryable, err)
+		}
+		if !strings.Contains(err.Error(), "app.cisco.com") || !strings.Contains(err.Error(), "details") {
+			t.Errorf("status %d: error %q does not name the cname and the response", test.status, err)
+		}
+	}
+}
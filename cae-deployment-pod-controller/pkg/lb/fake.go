@@ -0,0 +1,165 @@
+package lb
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Fake is an in-memory load balancer. It implements Client directly, and its
+// Handler serves the same NITRO API as the real one, so HTTPClient can be run
+// against it with httptest.NewServer.
+type Fake struct {
+	// Username and Password, when set, must be sent in the X-NITRO-USER and
+	// X-NITRO-PASS headers of every request to the Handler
+	Username string
+	Password string
+
+	lock     sync.Mutex
+	services map[string]*Service
+	monitors map[string]*Monitor
+	updates  int
+}
+
+// NewFake returns an empty fake.
+func NewFake() *Fake {
+	return &Fake{services: map[string]*Service{}, monitors: map[string]*Monitor{}}
+}
+
+// AddService adds or replaces a service.
+func (f *Fake) AddService(service *Service) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.services[service.Name] = service.DeepCopy()
+}
+
+// AddMonitor adds or replaces a monitor.
+func (f *Fake) AddMonitor(monitor *Monitor) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.monitors[monitor.Name] = monitor.DeepCopy()
+}
+
+// GetService returns the service, or nil if there is none.
+func (f *Fake) GetService(name string) (*Service, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if service, exists := f.services[name]; exists {
+		return service.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+// UpdateService sets the service name and IP of the service where they are not
+// empty, adding the service if there is none.
+func (f *Fake) UpdateService(service *Service) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	current, exists := f.services[service.Name]
+	if !exists {
+		current = &Service{Name: service.Name}
+		f.services[service.Name] = current
+	}
+	setFields(&current.ServiceName, service.ServiceName, &current.IP, service.IP)
+	f.updates++
+	return nil
+}
+
+// GetMonitor returns the monitor, or nil if there is none.
+func (f *Fake) GetMonitor(name string) (*Monitor, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if monitor, exists := f.monitors[name]; exists {
+		return monitor.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+// UpdateMonitor sets the service name and IP of the monitor where they are not
+// empty, adding the monitor if there is none.
+func (f *Fake) UpdateMonitor(monitor *Monitor) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	current, exists := f.monitors[monitor.Name]
+	if !exists {
+		current = &Monitor{Name: monitor.Name}
+		f.monitors[monitor.Name] = current
+	}
+	setFields(&current.ServiceName, monitor.ServiceName, &current.IP, monitor.IP)
+	f.updates++
+	return nil
+}
+
+// setFields sets the fields, given as pointer, value pairs, to the values that are
+// not empty.
+func setFields(fields ...interface{}) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if value := fields[i+1].(string); len(value) > 0 {
+			*fields[i].(*string) = value
+		}
+	}
+}
+
+// Updates returns how many services and monitors were updated.
+func (f *Fake) Updates() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.updates
+}
+
+// Handler serves the services and monitors over the NITRO API. Like NITRO, which
+// rejects the read-only ones, it rejects updates sending back any settings.
+func (f *Fake) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(f.Username) > 0 || len(f.Password) > 0 {
+			if r.Header.Get("X-NITRO-USER") != f.Username || r.Header.Get("X-NITRO-PASS") != f.Password {
+				http.Error(w, "invalid credentials", http.StatusUnauthorized)
+				return
+			}
+		}
+		if !strings.HasPrefix(r.URL.Path, configPath) {
+			http.NotFound(w, r)
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, configPath), "/", 2)
+		resource := parts[0]
+
+		var object interface{}
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 2 && resource == serviceResource:
+			if service, _ := f.GetService(parts[1]); service != nil {
+				object = []*Service{service}
+			}
+		case r.Method == http.MethodGet && len(parts) == 2 && resource == monitorResource:
+			if monitor, _ := f.GetMonitor(parts[1]); monitor != nil {
+				object = []*Monitor{monitor}
+			}
+		case r.Method == http.MethodPut && len(parts) == 1 && resource == serviceResource:
+			body := map[string]*Service{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body[resource] == nil || len(body[resource].Settings) > 0 {
+				http.Error(w, "invalid service", http.StatusBadRequest)
+				return
+			}
+			f.UpdateService(body[resource])
+			w.WriteHeader(http.StatusOK)
+			return
+		case r.Method == http.MethodPut && len(parts) == 1 && resource == monitorResource:
+			body := map[string]*Monitor{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body[resource] == nil || len(body[resource].Settings) > 0 {
+				http.Error(w, "invalid monitor", http.StatusBadRequest)
+				return
+			}
+			f.UpdateMonitor(body[resource])
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if object == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{resource: object})
+	})
+}
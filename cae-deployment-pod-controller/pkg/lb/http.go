@@ -0,0 +1,120 @@
+package lb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/httpapi"
+)
+
+const (
+	// configPath is the NITRO configuration API
+	configPath = "/nitro/v1/config/"
+
+	serviceResource = "service"
+	monitorResource = "lbmonitor"
+)
+
+// HTTPClient talks to the NetScaler NITRO API, authenticating with the NITRO
+// headers.
+type HTTPClient struct {
+	*httpapi.Client
+}
+
+// NewHTTPClient returns a client of the NITRO API of the load balancer at url.
+// NITRO has no sessions here, the credentials are sent with every request, each
+// of which fails after the timeout.
+func NewHTTPClient(url, username, password string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{httpapi.NewClient("the load balancer", url, timeout, nitroAuth(username, password))}
+}
+
+// nitroAuth authenticates requests with the NITRO headers.
+func nitroAuth(username, password string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set("X-NITRO-USER", username)
+		req.Header.Set("X-NITRO-PASS", password)
+	}
+}
+
+// GetService returns the service, or nil if there is none.
+func (c *HTTPClient) GetService(name string) (*Service, error) {
+	var services []*Service
+	found, err := c.get(serviceResource, name, &services)
+	if err != nil || !found || len(services) == 0 {
+		return nil, err
+	}
+	return services[0], nil
+}
+
+// UpdateService sets the service name and IP of the service.
+func (c *HTTPClient) UpdateService(service *Service) error {
+	return c.update(serviceResource, service.Name, service.updateFields())
+}
+
+// GetMonitor returns the monitor, or nil if there is none.
+func (c *HTTPClient) GetMonitor(name string) (*Monitor, error) {
+	var monitors []*Monitor
+	found, err := c.get(monitorResource, name, &monitors)
+	if err != nil || !found || len(monitors) == 0 {
+		return nil, err
+	}
+	return monitors[0], nil
+}
+
+// UpdateMonitor sets the service name and IP of the monitor.
+func (c *HTTPClient) UpdateMonitor(monitor *Monitor) error {
+	return c.update(monitorResource, monitor.Name, monitor.updateFields())
+}
+
+// get fetches the named object of the resource into objects, a pointer to a slice,
+// since NITRO wraps every response in a list under the resource name. It reports
+// false when the object does not exist.
+func (c *HTTPClient) get(resource, name string, objects interface{}) (bool, error) {
+	resp, err := c.Do(http.MethodGet, objectPath(resource, name), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := httpapi.CheckStatus(resp, "Error getting %s %s on the load balancer", resource, name); err != nil {
+		return false, err
+	}
+	body := map[string]json.RawMessage{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, fmt.Errorf("Error decoding %s %s from the load balancer: %v", resource, name, err)
+	}
+	if err := json.Unmarshal(body[resource], objects); err != nil {
+		return false, fmt.Errorf("Error decoding %s %s from the load balancer: %v", resource, name, err)
+	}
+	return true, nil
+}
+
+// update sends the fields of the named object under the resource name.
+func (c *HTTPClient) update(resource, name string, fields map[string]string) error {
+	body, err := json.Marshal(map[string]interface{}{resource: fields})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(http.MethodPut, objectPath(resource, ""), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return httpapi.CheckStatus(resp, "Error updating %s %s on the load balancer", resource, name)
+}
+
+// objectPath returns the path of the resource, or the named object of it.
+func objectPath(resource, name string) string {
+	path := configPath + resource
+	if len(name) > 0 {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
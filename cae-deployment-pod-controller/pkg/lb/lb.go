@@ -0,0 +1,152 @@
+// Package lb is the client of the NetScaler load balancers in front of the reverse
+// proxies (RPs). Each route host has a service sending its traffic to an RP and a
+// monitor checking that RP, both named after the host.
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// the fields the controller manages, every other one is passed through
+	nameField        = "name"
+	monitorNameField = "monitorname"
+	serviceNameField = "servicename"
+	serviceIPField   = "ipaddress"
+	monitorIPField   = "destip"
+)
+
+// Client gets and updates the load balancer services and monitors of route hosts.
+type Client interface {
+	// GetService returns the service of the host, or nil if there is none
+	GetService(name string) (*Service, error)
+	// UpdateService sets the service name and IP of the named service where they
+	// are not empty, leaving its settings as they are
+	UpdateService(service *Service) error
+	// GetMonitor returns the monitor of the host, or nil if there is none
+	GetMonitor(name string) (*Monitor, error)
+	// UpdateMonitor sets the service name and IP of the named monitor where they
+	// are not empty, leaving its settings as they are
+	UpdateMonitor(monitor *Monitor) error
+}
+
+// Service sends the traffic of a route host to the IP of an RP.
+type Service struct {
+	Name        string
+	ServiceName string
+	IP          string
+	// Settings are the other fields of the service, kept as the API returned them
+	Settings map[string]interface{}
+}
+
+// Monitor checks the health of an RP for a route host.
+type Monitor struct {
+	Name        string
+	ServiceName string
+	IP          string
+	// Settings are the other fields of the monitor, kept as the API returned them
+	Settings map[string]interface{}
+}
+
+// MarshalJSON merges the managed fields into the settings.
+func (s *Service) MarshalJSON() ([]byte, error) {
+	return marshalObject(s.Settings, nameField, s.Name, serviceNameField, s.ServiceName, serviceIPField, s.IP)
+}
+
+// UnmarshalJSON splits the managed fields from the settings.
+func (s *Service) UnmarshalJSON(data []byte) error {
+	settings, err := unmarshalObject(data, nameField, &s.Name, serviceNameField, &s.ServiceName, serviceIPField, &s.IP)
+	s.Settings = settings
+	return err
+}
+
+// MarshalJSON merges the managed fields into the settings.
+func (m *Monitor) MarshalJSON() ([]byte, error) {
+	return marshalObject(m.Settings, monitorNameField, m.Name, serviceNameField, m.ServiceName, monitorIPField, m.IP)
+}
+
+// UnmarshalJSON splits the managed fields from the settings.
+func (m *Monitor) UnmarshalJSON(data []byte) error {
+	settings, err := unmarshalObject(data, monitorNameField, &m.Name, serviceNameField, &m.ServiceName, monitorIPField, &m.IP)
+	m.Settings = settings
+	return err
+}
+
+// updateFields returns the fields sent to update the service.
+func (s *Service) updateFields() map[string]string {
+	return updateObject(nameField, s.Name, serviceNameField, s.ServiceName, serviceIPField, s.IP)
+}
+
+// updateFields returns the fields sent to update the monitor.
+func (m *Monitor) updateFields() map[string]string {
+	return updateObject(monitorNameField, m.Name, serviceNameField, m.ServiceName, monitorIPField, m.IP)
+}
+
+// DeepCopy returns a copy of the service. Settings are copied one level deep, they
+// are only ever passed through.
+func (s *Service) DeepCopy() *Service {
+	copy := *s
+	copy.Settings = copySettings(s.Settings)
+	return &copy
+}
+
+// DeepCopy returns a copy of the monitor. Settings are copied one level deep, they
+// are only ever passed through.
+func (m *Monitor) DeepCopy() *Monitor {
+	copy := *m
+	copy.Settings = copySettings(m.Settings)
+	return &copy
+}
+
+func copySettings(settings map[string]interface{}) map[string]interface{} {
+	copy := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		copy[key] = value
+	}
+	return copy
+}
+
+// marshalObject encodes the settings with the managed fields, given as key, value
+// pairs, set on top.
+func marshalObject(settings map[string]interface{}, fields ...string) ([]byte, error) {
+	object := copySettings(settings)
+	for i := 0; i+1 < len(fields); i += 2 {
+		object[fields[i]] = fields[i+1]
+	}
+	return json.Marshal(object)
+}
+
+// updateObject returns the body of an update: the name and the other managed fields
+// that are set, given as key, value pairs with the name first. The settings are
+// never sent back, NITRO rejects the read-only ones and keeps the omitted ones.
+func updateObject(fields ...string) map[string]string {
+	object := map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if i == 0 || len(fields[i+1]) > 0 {
+			object[fields[i]] = fields[i+1]
+		}
+	}
+	return object
+}
+
+// unmarshalObject decodes an object, storing the managed fields, given as key,
+// pointer pairs, and returning the remaining settings.
+func unmarshalObject(data []byte, fields ...interface{}) (map[string]interface{}, error) {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fields[i].(string)
+		if value, exists := object[key]; exists {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %s is %T, not a string", key, value)
+			}
+			*fields[i+1].(*string) = s
+			delete(object, key)
+		}
+	}
+	return object, nil
+}
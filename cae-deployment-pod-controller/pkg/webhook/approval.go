@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// patchOperation is a JSON patch operation returned by the mutating webhook.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// objectMeta is the part of any object the mutating webhook looks at.
+type objectMeta struct {
+	metav1.ObjectMeta `json:"metadata"`
+}
+
+// annotationPath returns the JSON patch path of the annotation.
+func annotationPath(key string) string {
+	return "/metadata/annotations/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// recordApprover sets the approved-by annotation of a Quarantine to the user whose
+// request sets or changes its approval annotation, replacing anything the request
+// put there, so that a decision is always attributed to whoever made it. Requests
+// changing only the approved-by annotation are denied.
+func (s *Server) recordApprover(req *admissionv1beta1.AdmissionRequest) (bool, string, []patchOperation, error) {
+	if req.Resource.Resource != "quarantines" || req.SubResource != "" ||
+		(req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update) {
+		return true, "", nil, nil
+	}
+
+	old, new := &objectMeta{}, &objectMeta{}
+	if err := json.Unmarshal(req.Object.Raw, new); err != nil {
+		return true, "", nil, fmt.Errorf("Error decoding Quarantine: %v", err)
+	}
+	if req.Operation == admissionv1beta1.Update {
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return true, "", nil, fmt.Errorf("Error decoding old Quarantine: %v", err)
+		}
+	}
+
+	oldAnnotations, annotations := old.GetAnnotations(), new.GetAnnotations()
+	decision := annotations[quarantinev1alpha1.ApprovalAnnotation]
+	switch {
+	case len(decision) > 0 && decision != oldAnnotations[quarantinev1alpha1.ApprovalAnnotation]:
+		return true, "", []patchOperation{{
+			Op:    "add",
+			Path:  annotationPath(quarantinev1alpha1.ApprovedByAnnotation),
+			Value: req.UserInfo.Username,
+		}}, nil
+	case annotations[quarantinev1alpha1.ApprovedByAnnotation] != oldAnnotations[quarantinev1alpha1.ApprovedByAnnotation]:
+		return false, fmt.Sprintf("the %s annotation is recorded from the user setting the %s annotation and cannot be set directly",
+			quarantinev1alpha1.ApprovedByAnnotation, quarantinev1alpha1.ApprovalAnnotation), nil, nil
+	}
+	return true, "", nil, nil
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/config"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// containerImages returns the image of every container and init container of the
+// pod spec, by container name.
+func containerImages(spec *v1.PodSpec) map[string]string {
+	images := map[string]string{}
+	if spec == nil {
+		return images
+	}
+	for _, container := range spec.InitContainers {
+		images[container.Name] = container.Image
+	}
+	for _, container := range spec.Containers {
+		images[container.Name] = container.Image
+	}
+	return images
+}
+
+// templatedPodOwners are the kinds whose pods are created from a pod template that
+// was checked when the workload was created or changed. Their pods are not checked
+// again, so scale-ups, evictions and rescheduling still work.
+var templatedPodOwners = map[string]bool{
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+}
+
+// imagesUnderReview decodes the request and returns the name of the workload, the
+// images of its containers, and the images it had before an update. Only images
+// that are new are checked, so existing workloads can still be scaled and edited.
+// Pods created by a ReplicaSet or ReplicationController are not checked at all,
+// their images are checked on the Deployment or DeploymentConfig.
+func (s *Server) imagesUnderReview(req *admissionv1beta1.AdmissionRequest) (string, map[string]string, map[string]string, error) {
+	old := map[string]string{}
+	switch req.Resource.Resource {
+	case "pods":
+		pod := &v1.Pod{}
+		if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+			return "", nil, nil, fmt.Errorf("Error decoding Pod: %v", err)
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil && templatedPodOwners[owner.Kind] {
+			return "", nil, nil, nil
+		}
+		if req.Operation == admissionv1beta1.Update {
+			oldPod := &v1.Pod{}
+			if err := json.Unmarshal(req.OldObject.Raw, oldPod); err != nil {
+				return "", nil, nil, fmt.Errorf("Error decoding old Pod: %v", err)
+			}
+			old = containerImages(&oldPod.Spec)
+		}
+		return s.Lookup.PodWorkloadName(pod), containerImages(&pod.Spec), old, nil
+	case "deployments", "deploymentconfigs":
+		new := &workload{}
+		if err := json.Unmarshal(req.Object.Raw, new); err != nil {
+			return "", nil, nil, fmt.Errorf("Error decoding %s: %v", resourceKinds[req.Resource.Resource], err)
+		}
+		if req.Operation == admissionv1beta1.Update {
+			oldWorkload := &workload{}
+			if err := json.Unmarshal(req.OldObject.Raw, oldWorkload); err != nil {
+				return "", nil, nil, fmt.Errorf("Error decoding old %s: %v", resourceKinds[req.Resource.Resource], err)
+			}
+			old = containerImages(oldWorkload.podSpec())
+		}
+		return new.Name, containerImages(new.podSpec()), old, nil
+	}
+	return "", nil, nil, nil
+}
+
+// validateImages warns about or denies pods and workloads referencing a blocked
+// image, depending on the namespace's image admission action. References by a tag a
+// blocked digest ran under are only warned about, the tag may have moved since.
+func (s *Server) validateImages(req *admissionv1beta1.AdmissionRequest) (bool, string, []string, error) {
+	if req.SubResource != "" || (req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update) {
+		return true, "", nil, nil
+	}
+	action := s.Lookup.ImageAdmission(req.Namespace)
+	if action == config.AdmissionDisabled {
+		return true, "", nil, nil
+	}
+
+	name, images, old, err := s.imagesUnderReview(req)
+	if err != nil {
+		return true, "", nil, err
+	}
+	var blocked, tagged []string
+	for container, image := range images {
+		if old[container] == image {
+			continue
+		}
+		reason, exact, err := s.Lookup.ImageBlock(req.Namespace, name, image)
+		if err != nil {
+			return true, "", nil, err
+		}
+		switch {
+		case len(reason) == 0:
+		case exact:
+			blocked = append(blocked, fmt.Sprintf("container %s: %s", container, reason))
+		default:
+			tagged = append(tagged, fmt.Sprintf("container %s: %s", container, reason))
+		}
+	}
+
+	if action == config.AdmissionDeny && len(blocked) > 0 {
+		return false, fmt.Sprintf("%s references a blocked image, unblock it with 'deploymentpodctl images unblock <digest>': %s",
+			req.Resource.Resource, strings.Join(blocked, "; ")), nil, nil
+	}
+	return true, "", append(blocked, tagged...), nil
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// OverrideAnnotation set to "true" on a quarantined workload lets it be scaled
+	// up or rolled out again without restoring it
+	OverrideAnnotation = "xxx.xxx.com/quarantine-override"
+
+	// restartedAtAnnotation is set on the pod template by 'kubectl rollout restart'
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// resourceKinds maps the resources the webhook validates to workload kinds.
+var resourceKinds = map[string]string{
+	"deployments":       "Deployment",
+	"deploymentconfigs": "DeploymentConfig",
+}
+
+// workload is the part of a Deployment or DeploymentConfig the webhooks look at.
+// Both share the shape, except that a DeploymentConfig's replicas are not a pointer.
+type workload struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Replicas *int32              `json:"replicas"`
+		Paused   bool                `json:"paused"`
+		Template *v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+func (w *workload) replicas() int32 {
+	if w.Spec.Replicas == nil {
+		return 1
+	}
+	return *w.Spec.Replicas
+}
+
+// podSpec returns the pod spec of the workload's template, or nil if it has none.
+func (w *workload) podSpec() *v1.PodSpec {
+	if w.Spec.Template == nil {
+		return nil
+	}
+	return &w.Spec.Template.Spec
+}
+
+// templateWithoutRestart returns the pod template without the annotation set by a
+// rollout restart, which is the only change such a restart makes.
+func (w *workload) templateWithoutRestart() *v1.PodTemplateSpec {
+	if w.Spec.Template == nil {
+		return nil
+	}
+	template := w.Spec.Template.DeepCopy()
+	delete(template.Annotations, restartedAtAnnotation)
+	if len(template.Annotations) == 0 {
+		template.Annotations = nil
+	}
+	return template
+}
+
+// rolloutChange describes how an update of the workload brings its pods back, or
+// returns an empty string if it does not. Scaling up does, and so do rollouts that
+// leave the pod template unchanged: a rollout restart or resuming paused rollouts.
+// Rollouts of a changed template are allowed, since they may carry the fix.
+func rolloutChange(old, new *workload) string {
+	if new.replicas() > old.replicas() {
+		return fmt.Sprintf("scaling from %d to %d replicas", old.replicas(), new.replicas())
+	}
+	if !equality.Semantic.DeepEqual(old.templateWithoutRestart(), new.templateWithoutRestart()) {
+		return ""
+	}
+	if old.Spec.Template != nil && new.Spec.Template != nil &&
+		old.Spec.Template.Annotations[restartedAtAnnotation] != new.Spec.Template.Annotations[restartedAtAnnotation] {
+		return "restarting the rollout of the unchanged pod template"
+	}
+	if old.Spec.Paused && !new.Spec.Paused {
+		return "resuming rollouts of the unchanged pod template"
+	}
+	return ""
+}
+
+// scaleChange describes the change of a scale subresource update, or returns an
+// empty string if it does not scale up.
+func scaleChange(req *admissionv1beta1.AdmissionRequest) (string, error) {
+	old, new := &autoscalingv1.Scale{}, &autoscalingv1.Scale{}
+	if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+		return "", fmt.Errorf("Error decoding old Scale: %v", err)
+	}
+	if err := json.Unmarshal(req.Object.Raw, new); err != nil {
+		return "", fmt.Errorf("Error decoding Scale: %v", err)
+	}
+	if new.Spec.Replicas > old.Spec.Replicas {
+		return fmt.Sprintf("scaling from %d to %d replicas", old.Spec.Replicas, new.Spec.Replicas), nil
+	}
+	return "", nil
+}
+
+// validateQuarantine denies bringing back the pods of a workload with an Active
+// Quarantine, unless the override annotation is set on it. Workload updates, the
+// scale subresource and DeploymentConfig instantiations ('oc rollout latest') are
+// all covered.
+func (s *Server) validateQuarantine(req *admissionv1beta1.AdmissionRequest) (bool, string, []string, error) {
+	kind, watched := resourceKinds[req.Resource.Resource]
+	if !watched {
+		return true, "", nil, nil
+	}
+
+	var change string
+	var annotations map[string]string
+	switch {
+	case req.SubResource == "" && req.Operation == admissionv1beta1.Update:
+		old, new := &workload{}, &workload{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return true, "", nil, fmt.Errorf("Error decoding old %s: %v", kind, err)
+		}
+		if err := json.Unmarshal(req.Object.Raw, new); err != nil {
+			return true, "", nil, fmt.Errorf("Error decoding %s: %v", kind, err)
+		}
+		change, annotations = rolloutChange(old, new), new.GetAnnotations()
+	case req.SubResource == "scale" && req.Operation == admissionv1beta1.Update:
+		var err error
+		if change, err = scaleChange(req); err != nil {
+			return true, "", nil, err
+		}
+	case req.SubResource == "instantiate" && req.Operation == admissionv1beta1.Create:
+		change = "rolling out the unchanged pod template"
+	}
+	if len(change) == 0 {
+		return true, "", nil, nil
+	}
+
+	quarantine, err := s.Lookup.ActiveQuarantine(kind, req.Namespace, req.Name)
+	if err != nil || quarantine == nil {
+		return true, "", nil, err
+	}
+
+	// subresource requests do not carry the workload, its annotations come from the cache
+	if annotations == nil {
+		if annotations, err = s.Lookup.WorkloadAnnotations(kind, req.Namespace, req.Name); err != nil {
+			return true, "", nil, err
+		}
+	}
+	if annotations[OverrideAnnotation] == "true" {
+		warning := fmt.Sprintf("%s %s is quarantined by Quarantine %s, %s is allowed by the %s annotation", kind, req.Name, quarantine.Name, change, OverrideAnnotation)
+		return true, "", []string{warning}, nil
+	}
+	return false, quarantineMessage(quarantine, change), nil, nil
+}
+
+// quarantineMessage explains the denial, naming the incident and how to get past it.
+func quarantineMessage(quarantine *quarantinev1alpha1.Quarantine, change string) string {
+	workload := quarantine.Spec.Workload
+	since := quarantine.CreationTimestamp
+	if quarantine.Status.QuarantinedAt != nil {
+		since = *quarantine.Status.QuarantinedAt
+	}
+	return fmt.Sprintf("%s %s is quarantined by Quarantine %s/%s since %s (%s: %s), %s is not allowed. "+
+		"Restore it with 'deploymentpodctl restore %s/%s', or set the %s annotation to \"true\" to override",
+		workload.Kind, workload.Name, quarantine.Namespace, quarantine.Name, since.UTC().Format("2006-01-02 15:04:05 MST"),
+		quarantine.Spec.Action, quarantine.Spec.Reason, change, quarantine.Namespace, workload.Name, OverrideAnnotation)
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// the keys of a kubernetes.io/tls Secret, as mounted into the cert directory
+	certFileName = "tls.crt"
+	keyFileName  = "tls.key"
+)
+
+// certLoader serves the certificate from a mounted Secret, reloading it when the
+// kubelet updates the files, so certificates can be rotated without a restart.
+type certLoader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertLoader loads the certificate from the directory, failing if it is missing
+// or invalid.
+func newCertLoader(certDir string) (*certLoader, error) {
+	loader := &certLoader{
+		certFile: filepath.Join(certDir, certFileName),
+		keyFile:  filepath.Join(certDir, keyFileName),
+	}
+	if _, err := loader.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config. When reloading
+// fails the last good certificate stays in use.
+func (l *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	info, err := os.Stat(l.certFile)
+	if err == nil && l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(l.certFile, l.keyFile); err == nil {
+			if l.cert != nil {
+				klog.Infof("Reloaded webhook certificate %s", l.certFile)
+			}
+			l.cert, l.modTime = &cert, info.ModTime()
+			return l.cert, nil
+		}
+	}
+
+	if l.cert != nil {
+		klog.Errorf("Error reloading webhook certificate %s, keeping the last one: %v", l.certFile, err)
+		return l.cert, nil
+	}
+	return nil, fmt.Errorf("Error loading webhook certificate %s: %v", l.certFile, err)
+}
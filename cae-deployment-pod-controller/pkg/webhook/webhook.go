@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	quarantinev1alpha1 "gitscm.cisco.com/scm/eps-kube/cae-route-controller/pkg/apis/quarantine/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// QuarantinePath validates scale-ups and rollouts of quarantined workloads
+	QuarantinePath = "/validate-quarantine"
+	// ImagesPath validates the images of new pods and workloads
+	ImagesPath = "/validate-images"
+	// ApprovalPath records who approved or rejected a Pending Quarantine
+	ApprovalPath = "/mutate-approval"
+
+	// maxRequestBytes bounds the AdmissionReview bodies read
+	maxRequestBytes = 3 * 1024 * 1024
+)
+
+// Lookup is how the webhook learns about workloads and their Quarantines, from the
+// controller's informer caches.
+type Lookup interface {
+	// ActiveQuarantine returns the Active Quarantine of the workload, or nil
+	ActiveQuarantine(kind, namespace, name string) (*quarantinev1alpha1.Quarantine, error)
+	// WorkloadAnnotations returns the annotations of the workload, or nil if it is
+	// unknown
+	WorkloadAnnotations(kind, namespace, name string) (map[string]string, error)
+	// PodWorkloadName returns the name of the workload the pod belongs to
+	PodWorkloadName(pod *v1.Pod) string
+	// ImageAdmission returns the image admission action in effect in the namespace
+	ImageAdmission(namespace string) string
+	// ImageBlock explains why the image is blocked for the workload, or returns an
+	// empty string if it is not, and whether it is the blocked digest itself rather
+	// than a tag it ran under
+	ImageBlock(namespace, workload, image string) (string, bool, error)
+}
+
+// Server is the validating admission webhook. It fails open: any request it cannot
+// decode or evaluate is allowed, so an outage of the controller never blocks
+// deployments.
+type Server struct {
+	Lookup Lookup
+	// TrustedUsers are allowed through unconditionally, such as the controller's
+	// own service account, which restores quarantined workloads
+	TrustedUsers []string
+
+	certs *certLoader
+}
+
+// NewServer returns a webhook server using the certificate in certDir, where the
+// webhook's kubernetes.io/tls Secret is mounted.
+func NewServer(lookup Lookup, certDir string, trustedUsers ...string) (*Server, error) {
+	certs, err := newCertLoader(certDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Lookup: lookup, TrustedUsers: trustedUsers, certs: certs}, nil
+}
+
+// Handler returns the webhook's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(QuarantinePath, s.serve(s.validateQuarantine))
+	mux.HandleFunc(ImagesPath, s.serve(s.validateImages))
+	mux.HandleFunc(ApprovalPath, s.serveMutation(s.recordApprover))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// ListenAndServe serves the webhook over TLS on addr until stopCh is closed.
+func (s *Server) ListenAndServe(addr string, stopCh <-chan struct{}) error {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      s.Handler(),
+		TLSConfig:    &tls.Config{GetCertificate: s.certs.GetCertificate, MinVersion: tls.VersionTLS12},
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("Error shutting down webhook server: %v", err)
+		}
+	}()
+
+	klog.Infof("Serving admission webhook on %s", addr)
+	if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// validateFunc evaluates an admission request. It returns whether the request is
+// allowed, the denial message if not, and any warnings to return to the client.
+type validateFunc func(req *admissionv1beta1.AdmissionRequest) (allowed bool, message string, warnings []string, err error)
+
+// mutateFunc evaluates an admission request like a validateFunc, returning the JSON
+// patch to apply to the object instead of warnings.
+type mutateFunc func(req *admissionv1beta1.AdmissionRequest) (allowed bool, message string, patch []patchOperation, err error)
+
+// evaluateFunc evaluates an admission request into the response.
+type evaluateFunc func(req *admissionv1beta1.AdmissionRequest, response *admissionv1beta1.AdmissionResponse) error
+
+// serve decodes the AdmissionReview, runs validate on it and writes the response.
+func (s *Server) serve(validate validateFunc) http.HandlerFunc {
+	return s.serveReview(func(req *admissionv1beta1.AdmissionRequest, response *admissionv1beta1.AdmissionResponse) error {
+		allowed, message, warnings, err := validate(req)
+		if err != nil {
+			return err
+		}
+		response.Warnings = warnings
+		deny(response, allowed, message)
+		return nil
+	})
+}
+
+// serveMutation decodes the AdmissionReview, runs mutate on it and writes the
+// response with the patch.
+func (s *Server) serveMutation(mutate mutateFunc) http.HandlerFunc {
+	return s.serveReview(func(req *admissionv1beta1.AdmissionRequest, response *admissionv1beta1.AdmissionResponse) error {
+		allowed, message, patch, err := mutate(req)
+		if err != nil {
+			return err
+		}
+		if len(patch) > 0 {
+			data, err := json.Marshal(patch)
+			if err != nil {
+				return fmt.Errorf("Error encoding patch: %v", err)
+			}
+			patchType := admissionv1beta1.PatchTypeJSONPatch
+			response.Patch, response.PatchType = data, &patchType
+		}
+		deny(response, allowed, message)
+		return nil
+	})
+}
+
+// deny sets the response to a denial with the message, unless allowed.
+func deny(response *admissionv1beta1.AdmissionResponse, allowed bool, message string) {
+	response.Allowed = allowed
+	if !allowed {
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+			Message: message,
+		}
+	}
+}
+
+// serveReview decodes the AdmissionReview, runs evaluate on it and writes the
+// response. Requests of trusted users, and requests evaluate fails on, are allowed
+// unchanged.
+func (s *Server) serveReview(evaluate evaluateFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading request: %v", err), http.StatusBadRequest)
+			return
+		}
+		review := &admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+			http.Error(w, "Invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		req := review.Request
+		response := &admissionv1beta1.AdmissionResponse{UID: req.UID, Allowed: true}
+		if s.trusted(req.UserInfo.Username) {
+			klog.V(4).Infof("Allowing %s of %s %s/%s by trusted user %s", req.Operation, req.Resource.Resource, req.Namespace, req.Name, req.UserInfo.Username)
+		} else if err := evaluate(req, response); err != nil {
+			klog.Errorf("Error validating %s of %s %s/%s, allowing it: %v", req.Operation, req.Resource.Resource, req.Namespace, req.Name, err)
+			response = &admissionv1beta1.AdmissionResponse{UID: req.UID, Allowed: true}
+		} else if !response.Allowed {
+			klog.Infof("Denied %s of %s %s/%s by %s: %s", req.Operation, req.Resource.Resource, req.Namespace, req.Name, req.UserInfo.Username, response.Result.Message)
+		}
+
+		review.Response = response
+		review.Request = nil
+		data, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// trusted reports whether the user is allowed through unconditionally.
+func (s *Server) trusted(username string) bool {
+	for _, user := range s.TrustedUsers {
+		if user == username {
+			return true
+		}
+	}
+	return false
+}